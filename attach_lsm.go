@@ -0,0 +1,39 @@
+package ebpf
+
+import (
+	"github.com/pkg/errors"
+)
+
+type lsmAttachment struct {
+	fd int
+}
+
+func (l *lsmAttachment) Close() error {
+	return closeFD(l.fd)
+}
+
+// AttachLSM attaches the program in secName as a BPF_LSM_MAC program to
+// the LSM hook named by its SEC("lsm/<hook>") section.
+func (coll *Collection) AttachLSM(secName string) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't attach LSM program %s", secName)
+	}
+	if prog.ProgramSpec.Type != LSM {
+		return errors.Wrapf(errors.New("not an LSM program"), "couldn't attach program %s", secName)
+	}
+
+	fd, err := bpfLinkCreate(prog.FD(), 0, bpfAttachTypeLSMMac)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't attach LSM program %s", secName)
+	}
+
+	coll.attach(secName, &lsmAttachment{fd: fd})
+	return nil
+}
+
+// DetachLSM removes the LSM attachment installed by AttachLSM for
+// secName, if any.
+func (coll *Collection) DetachLSM(secName string) error {
+	return coll.detach(secName)
+}
@@ -0,0 +1,111 @@
+package ebpf
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// PerfEventConfig selects the hardware or software perf counter a
+// PerfEvent program is attached to, mirroring the fields of
+// perf_event_attr that matter for this purpose.
+type PerfEventConfig struct {
+	// Type is one of the unix.PERF_TYPE_* constants, e.g.
+	// unix.PERF_TYPE_HARDWARE or unix.PERF_TYPE_SOFTWARE.
+	Type uint32
+	// Config is one of the unix.PERF_COUNT_* constants, e.g.
+	// unix.PERF_COUNT_HW_CPU_CYCLES.
+	Config uint64
+	// SamplePeriod triggers the program every SamplePeriod occurrences
+	// of the counter. Mutually exclusive with SampleFreq.
+	SamplePeriod uint64
+	// SampleFreq triggers the program SampleFreq times per second
+	// instead of every fixed number of occurrences.
+	SampleFreq uint64
+	// CPU restricts the counter to a single CPU; -1 attaches to every
+	// CPU the calling process can run on.
+	CPU int
+}
+
+type perfEventAttachment struct {
+	fds []int
+}
+
+func (p *perfEventAttachment) Close() error {
+	var firstErr error
+	for _, fd := range p.fds {
+		if err := unix.Close(fd); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// EnablePerfEvent attaches the program in secName to the hardware or
+// software perf counter described by cfg.
+func (coll *Collection) EnablePerfEvent(secName string, cfg PerfEventConfig) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't enable perf event %s", secName)
+	}
+	if prog.ProgramSpec.Type != PerfEvent {
+		return errors.Wrapf(errors.New("not a perf event program"), "couldn't enable program %s", secName)
+	}
+
+	cpus := []int{cfg.CPU}
+	if cfg.CPU < 0 {
+		cpus = make([]int, runtime.NumCPU())
+		for i := range cpus {
+			cpus[i] = i
+		}
+	}
+
+	attr := unix.PerfEventAttr{
+		Type:   cfg.Type,
+		Config: cfg.Config,
+		Bits:   unix.PerfBitDisabled,
+	}
+	if cfg.SampleFreq > 0 {
+		attr.Sample = cfg.SampleFreq
+		attr.Bits |= unix.PerfBitFreq
+	} else {
+		attr.Sample = cfg.SamplePeriod
+	}
+
+	var fds []int
+	for _, cpu := range cpus {
+		fd, err := unix.PerfEventOpen(&attr, -1, cpu, -1, unix.PERF_FLAG_FD_CLOEXEC)
+		if err != nil {
+			for _, opened := range fds {
+				unix.Close(opened)
+			}
+			return errors.Wrapf(err, "couldn't open perf event for cpu %d", cpu)
+		}
+
+		if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_SET_BPF, prog.FD()); err != nil {
+			unix.Close(fd)
+			for _, opened := range fds {
+				unix.Close(opened)
+			}
+			return errors.Wrapf(err, "couldn't attach program %s to perf event", secName)
+		}
+		if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+			unix.Close(fd)
+			for _, opened := range fds {
+				unix.Close(opened)
+			}
+			return errors.Wrapf(err, "couldn't enable perf event for program %s", secName)
+		}
+
+		fds = append(fds, fd)
+	}
+
+	coll.attach(secName, &perfEventAttachment{fds: fds})
+	return nil
+}
+
+// DisablePerfEvent removes the perf event attached to secName, if any.
+func (coll *Collection) DisablePerfEvent(secName string) error {
+	return coll.detach(secName)
+}
@@ -0,0 +1,55 @@
+package ebpf
+
+import (
+	"github.com/pkg/errors"
+)
+
+type rawTracepointAttachment struct {
+	fd int
+}
+
+func (r *rawTracepointAttachment) Close() error {
+	return closeFD(r.fd)
+}
+
+// EnableRawTracepoint attaches the program in secName to the raw
+// tracepoint named by its SEC("raw_tracepoint/<name>") section, via
+// BPF_RAW_TRACEPOINT_OPEN. Raw tracepoints see the tracepoint's
+// arguments directly rather than through the perf_event ring used by
+// EnableTracepoint, avoiding the data copy that format entails.
+func (coll *Collection) EnableRawTracepoint(secName string) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't enable raw tracepoint %s", secName)
+	}
+	if prog.ProgramSpec.Type != RawTracepoint {
+		return errors.Wrapf(errors.New("not a raw tracepoint program"), "couldn't enable program %s", secName)
+	}
+
+	name := rawTracepointName(secName)
+	fd, err := bpfRawTracepointOpen(name, prog.FD())
+	if err != nil {
+		return errors.Wrapf(err, "couldn't enable raw tracepoint %s", secName)
+	}
+
+	coll.attach(secName, &rawTracepointAttachment{fd: fd})
+	return nil
+}
+
+// DisableRawTracepoint removes the raw tracepoint attached to secName,
+// if any.
+func (coll *Collection) DisableRawTracepoint(secName string) error {
+	return coll.detach(secName)
+}
+
+// rawTracepointName strips the "raw_tracepoint/" (or "raw_tp/") SEC()
+// prefix to recover the tracepoint's bare
+// name, which is what BPF_RAW_TRACEPOINT_OPEN expects.
+func rawTracepointName(secName string) string {
+	for _, prefix := range []string{"raw_tracepoint/", "raw_tp/"} {
+		if len(secName) > len(prefix) && secName[:len(prefix)] == prefix {
+			return secName[len(prefix):]
+		}
+	}
+	return secName
+}
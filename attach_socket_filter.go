@@ -0,0 +1,39 @@
+package ebpf
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+type socketFilterAttachment struct {
+	fd int
+}
+
+func (s *socketFilterAttachment) Close() error {
+	return unix.SetsockoptInt(s.fd, unix.SOL_SOCKET, unix.SO_DETACH_BPF, 0)
+}
+
+// AttachSocketFilter attaches the program in secName to fd via
+// SO_ATTACH_BPF, so that it runs on every packet the socket receives.
+func (coll *Collection) AttachSocketFilter(secName string, fd int) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't attach socket filter %s", secName)
+	}
+	if prog.ProgramSpec.Type != SocketFilter {
+		return errors.Wrapf(errors.New("not a socket filter program"), "couldn't attach program %s", secName)
+	}
+
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ATTACH_BPF, prog.FD()); err != nil {
+		return errors.Wrapf(err, "couldn't attach socket filter %s", secName)
+	}
+
+	coll.attach(secName, &socketFilterAttachment{fd: fd})
+	return nil
+}
+
+// DetachSocketFilter removes the socket filter installed by
+// AttachSocketFilter for secName, if any.
+func (coll *Collection) DetachSocketFilter(secName string) error {
+	return coll.detach(secName)
+}
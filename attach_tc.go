@@ -0,0 +1,108 @@
+package ebpf
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// TCAttachPoint selects which clsact hook a TC program is installed on.
+type TCAttachPoint int
+
+const (
+	// TCIngress attaches the program to the ingress (RX) hook.
+	TCIngress TCAttachPoint = iota
+	// TCEgress attaches the program to the egress (TX) hook.
+	TCEgress
+)
+
+func (a TCAttachPoint) parent() uint32 {
+	if a == TCEgress {
+		return netlink.HANDLE_MIN_EGRESS
+	}
+	return netlink.HANDLE_MIN_INGRESS
+}
+
+type tcAttachment struct {
+	ifindex     int
+	attachPoint TCAttachPoint
+	priority    uint16
+}
+
+func (t *tcAttachment) Close() error {
+	link, err := netlink.LinkByIndex(t.ifindex)
+	if err != nil {
+		return errors.Wrapf(err, "looking up interface %d", t.ifindex)
+	}
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    t.attachPoint.parent(),
+			Handle:    netlink.MakeHandle(0, 1),
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  t.priority,
+		},
+	}
+	return netlink.FilterDel(filter)
+}
+
+// AttachTC attaches the program in secName to ifindex's clsact qdisc at
+// attachPoint with the given filter priority, creating the clsact qdisc
+// first if it doesn't already exist.
+func (coll *Collection) AttachTC(secName string, ifindex int, attachPoint TCAttachPoint, priority uint16) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't attach TC program %s", secName)
+	}
+	if prog.ProgramSpec.Type != SchedCLS && prog.ProgramSpec.Type != SchedACT {
+		return errors.Wrapf(errors.New("not a TC program"), "couldn't attach program %s", secName)
+	}
+
+	link, err := netlink.LinkByIndex(ifindex)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't attach TC program %s", secName)
+	}
+
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    netlink.HANDLE_CLSACT,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscAdd(qdisc); err != nil && !isExists(err) {
+		return errors.Wrapf(err, "couldn't create clsact qdisc for program %s", secName)
+	}
+
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    attachPoint.parent(),
+			Handle:    netlink.MakeHandle(0, 1),
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  priority,
+		},
+		Fd:           prog.FD(),
+		Name:         secName,
+		DirectAction: true,
+	}
+	if err := netlink.FilterAdd(filter); err != nil {
+		return errors.Wrapf(err, "couldn't attach TC program %s", secName)
+	}
+
+	coll.attach(secName, &tcAttachment{ifindex: ifindex, attachPoint: attachPoint, priority: priority})
+	return nil
+}
+
+// DetachTC removes the TC filter installed by AttachTC for secName, if
+// any.
+func (coll *Collection) DetachTC(secName string) error {
+	return coll.detach(secName)
+}
+
+func isExists(err error) bool {
+	return os.IsExist(err)
+}
@@ -0,0 +1,105 @@
+package ebpf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const uprobeEventsPath = "/sys/kernel/debug/tracing/uprobe_events"
+
+type uprobeAttachment struct {
+	group string
+	event string
+}
+
+func (u *uprobeAttachment) Close() error {
+	return removeUprobeEvent(u.group, u.event)
+}
+
+// EnableUprobe attaches the program in secName as a uprobe (or, if the
+// program is a uretprobe, a uretprobe) on symbol+offset in binaryPath.
+//
+// maxactive configures the maximum number of instances of the function
+// that can be probed simultaneously, exactly like EnableKprobe's
+// maxactive; it's only meaningful for uretprobes.
+func (coll *Collection) EnableUprobe(secName, binaryPath, symbol string, offset uint64, maxactive int) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't enable uprobe %s", secName)
+	}
+	if !prog.IsUProbe() && !prog.IsURetProbe() {
+		return errors.Wrapf(errors.New("not a uprobe"), "couldn't enable program %s", secName)
+	}
+
+	group := fmt.Sprintf("uprobes_%s", sanitizeEventName(secName))
+	event := sanitizeEventName(symbol)
+
+	if err := addUprobeEvent(group, event, binaryPath, symbol, offset, prog.IsURetProbe(), maxactive); err != nil {
+		return errors.Wrapf(err, "couldn't enable uprobe %s", secName)
+	}
+
+	if err := prog.attachPerfEvent(fmt.Sprintf("%s/%s", group, event)); err != nil {
+		removeUprobeEvent(group, event)
+		return errors.Wrapf(err, "couldn't enable uprobe %s", secName)
+	}
+
+	coll.attach(secName, &uprobeAttachment{group: group, event: event})
+	return nil
+}
+
+// DisableUprobe removes the uprobe attached to secName, if any.
+func (coll *Collection) DisableUprobe(secName string) error {
+	return coll.detach(secName)
+}
+
+func addUprobeEvent(group, event, binaryPath, symbol string, offset uint64, isRet bool, maxactive int) error {
+	prefix := "p"
+	if isRet {
+		prefix = "r"
+		if maxactive > 0 {
+			prefix = fmt.Sprintf("r%d", maxactive)
+		}
+	}
+
+	def := fmt.Sprintf("%s:%s/%s %s:%s", prefix, group, event, binaryPath, symbol)
+	if offset > 0 {
+		def = fmt.Sprintf("%s+0x%x", def, offset)
+	}
+
+	f, err := os.OpenFile(uprobeEventsPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "opening uprobe_events")
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(def); err != nil {
+		return errors.Wrapf(err, "writing %q to uprobe_events", def)
+	}
+	return nil
+}
+
+func removeUprobeEvent(group, event string) error {
+	f, err := os.OpenFile(uprobeEventsPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "opening uprobe_events")
+	}
+	defer f.Close()
+
+	def := fmt.Sprintf("-:%s/%s", group, event)
+	if _, err := f.WriteString(def); err != nil {
+		return errors.Wrapf(err, "writing %q to uprobe_events", def)
+	}
+	return nil
+}
+
+func sanitizeEventName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,65 @@
+package ebpf
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// XDPFlags selects the mode an XDP program is attached in.
+type XDPFlags uint32
+
+const (
+	// XDPFlagsGeneric attaches the program in the kernel's generic
+	// (SKB-based) XDP path, which works with any NIC driver but is the
+	// slowest mode.
+	XDPFlagsGeneric XDPFlags = 1 << (iota + 1)
+	// XDPFlagsDriver attaches the program in the NIC driver, which must
+	// have native XDP support.
+	XDPFlagsDriver
+	// XDPFlagsOffload offloads the program to a NIC capable of running
+	// eBPF in hardware.
+	XDPFlagsOffload
+)
+
+type xdpAttachment struct {
+	ifindex int
+	flags   XDPFlags
+}
+
+func (x *xdpAttachment) Close() error {
+	link, err := netlink.LinkByIndex(x.ifindex)
+	if err != nil {
+		return errors.Wrapf(err, "looking up interface %d", x.ifindex)
+	}
+	return netlink.LinkSetXdpFdWithFlags(link, -1, int(x.flags))
+}
+
+// AttachXDP attaches the program in secName to the network interface
+// ifindex as an XDP program, in the mode(s) selected by flags.
+func (coll *Collection) AttachXDP(secName string, ifindex int, flags XDPFlags) error {
+	prog, ok := coll.Programs[secName]
+	if !ok {
+		return errors.Wrapf(errors.New("section not found"), "couldn't attach XDP program %s", secName)
+	}
+	if prog.ProgramSpec.Type != XDP {
+		return errors.Wrapf(errors.New("not an XDP program"), "couldn't attach program %s", secName)
+	}
+
+	link, err := netlink.LinkByIndex(ifindex)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't attach XDP program %s", secName)
+	}
+
+	if err := netlink.LinkSetXdpFdWithFlags(link, prog.FD(), int(flags)); err != nil {
+		return errors.Wrapf(err, "couldn't attach XDP program %s", secName)
+	}
+
+	coll.attach(secName, &xdpAttachment{ifindex: ifindex, flags: flags})
+	return nil
+}
+
+// DetachXDP removes the XDP program attached to secName's interface, if
+// any.
+func (coll *Collection) DetachXDP(secName string) error {
+	return coll.detach(secName)
+}
@@ -0,0 +1,67 @@
+package ebpf
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// These mirror enum bpf_cmd / enum bpf_attach_type values the syscall
+// wrappers below need that aren't otherwise used (and hence not yet
+// defined) elsewhere in this package.
+const (
+	bpfCmdLinkCreate        = 28
+	bpfCmdRawTracepointOpen = 17
+
+	bpfAttachTypeLSMMac = 27
+)
+
+type bpfLinkCreateAttr struct {
+	ProgFD     uint32
+	TargetFD   uint32
+	AttachType uint32
+	Flags      uint32
+}
+
+// bpfLinkCreate wraps BPF_LINK_CREATE, used to attach programs (such as
+// LSM hooks) that are represented as a bpf_link rather than the older
+// per-subsystem attach mechanisms.
+func bpfLinkCreate(progFD, targetFD int, attachType uint32) (int, error) {
+	attr := bpfLinkCreateAttr{
+		ProgFD:     uint32(progFD),
+		TargetFD:   uint32(targetFD),
+		AttachType: attachType,
+	}
+
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, bpfCmdLinkCreate, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	if errno != 0 {
+		return 0, errors.Wrap(errno, "BPF_LINK_CREATE")
+	}
+	return int(fd), nil
+}
+
+type bpfRawTracepointOpenAttr struct {
+	Name   uint64
+	ProgFD uint32
+	_      uint32
+}
+
+// bpfRawTracepointOpen wraps BPF_RAW_TRACEPOINT_OPEN.
+func bpfRawTracepointOpen(name string, progFD int) (int, error) {
+	nameBytes := append([]byte(name), 0)
+	attr := bpfRawTracepointOpenAttr{
+		Name:   uint64(uintptr(unsafe.Pointer(&nameBytes[0]))),
+		ProgFD: uint32(progFD),
+	}
+
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, bpfCmdRawTracepointOpen, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	if errno != 0 {
+		return 0, errors.Wrap(errno, "BPF_RAW_TRACEPOINT_OPEN")
+	}
+	return int(fd), nil
+}
+
+func closeFD(fd int) error {
+	return unix.Close(fd)
+}
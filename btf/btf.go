@@ -0,0 +1,265 @@
+// Package btf parses the BPF Type Format, the debug info format used by
+// the kernel and by clang to describe C types, and implements Compile
+// Once - Run Everywhere (CO-RE) relocations against it.
+package btf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const btfMagic = 0xeB9F
+
+// btfHeader is the fixed-size header at the start of a .BTF section.
+type btfHeader struct {
+	Magic   uint16
+	Version uint8
+	Flags   uint8
+	HdrLen  uint32
+
+	TypeOff uint32
+	TypeLen uint32
+	StrOff  uint32
+	StrLen  uint32
+}
+
+// Type is a node in the BTF type graph. Every concrete type in this
+// package implements it.
+type Type interface {
+	// Name returns the type's name, which may be empty for anonymous
+	// types such as pointers or struct/union members.
+	Name() string
+
+	// id returns the type's ID as assigned while parsing, used to
+	// resolve references between types.
+	id() TypeID
+}
+
+// TypeID indexes into a Spec's Types, matching the kernel's BTF id space.
+type TypeID uint32
+
+type typeBase struct {
+	TypeName string
+	ID       TypeID
+}
+
+func (t *typeBase) Name() string { return t.TypeName }
+func (t *typeBase) id() TypeID   { return t.ID }
+
+// Void is the implicit type with ID 0.
+type Void struct{ typeBase }
+
+// Int is an integer of a given size, optionally signed, a bool or a char.
+type Int struct {
+	typeBase
+	Size     uint32
+	Signed   bool
+	Encoding string // "", "signed", "char" or "bool"
+}
+
+// Pointer points to another type.
+type Pointer struct {
+	typeBase
+	Target Type
+}
+
+// Array is a fixed-size array of Type.
+type Array struct {
+	typeBase
+	Index  Type
+	Type   Type
+	Nelems uint32
+}
+
+// Member is a single field of a Struct or Union.
+type Member struct {
+	Name         string
+	Type         Type
+	OffsetBits   uint32
+	BitfieldSize uint32
+}
+
+// Struct is a composite type with named, offset members.
+type Struct struct {
+	typeBase
+	Size    uint32
+	Members []Member
+}
+
+// Union is like Struct but all members share the same offset.
+type Union struct {
+	typeBase
+	Size    uint32
+	Members []Member
+}
+
+// Enum is a set of named integer constants.
+type Enum struct {
+	typeBase
+	Values map[string]int32
+}
+
+// Fwd is a forward declaration of a Struct or Union.
+type Fwd struct {
+	typeBase
+	Kind string // "struct" or "union"
+}
+
+// Typedef is a named alias for another type.
+type Typedef struct {
+	typeBase
+	Type Type
+}
+
+// Const, Volatile and Restrict are type qualifiers.
+type Const struct {
+	typeBase
+	Type Type
+}
+
+type Volatile struct {
+	typeBase
+	Type Type
+}
+
+type Restrict struct {
+	typeBase
+	Type Type
+}
+
+// FuncProto describes the signature of a function.
+type FuncProto struct {
+	typeBase
+	Return Type
+	Params []FuncParam
+}
+
+// FuncParam is a single parameter of a FuncProto.
+type FuncParam struct {
+	Name string
+	Type Type
+}
+
+// Var is a global variable, as emitted for CO-RE relocations against
+// `extern` declarations.
+type Var struct {
+	typeBase
+	Type    Type
+	Linkage string
+}
+
+// Datasec groups Vars that live in the same ELF section (e.g. .bss, .data).
+type Datasec struct {
+	typeBase
+	Size uint32
+	Vars []Var
+}
+
+// Spec is the parsed representation of a BTF blob: its types, the string
+// table they reference, and (when parsed from an object file) the CO-RE
+// relocations that apply to it.
+type Spec struct {
+	types           []Type
+	byName          map[string][]Type
+	strings         []byte
+	relocsBySection map[string][]CORERelocation
+}
+
+// stringAt looks up a NUL-terminated name in the BTF string table.
+func (s *Spec) stringAt(off uint32) string {
+	if int(off) >= len(s.strings) {
+		return ""
+	}
+	end := off
+	for end < uint32(len(s.strings)) && s.strings[end] != 0 {
+		end++
+	}
+	return string(s.strings[off:end])
+}
+
+// TypeByName returns every type in the Spec with the given name. BTF
+// allows multiple types (e.g. a struct and a typedef) to share a name.
+func (s *Spec) TypeByName(name string) []Type {
+	return s.byName[name]
+}
+
+// ExternNames returns the names of the `extern` symbols (map and global
+// variable references satisfied by a later linking step) declared by
+// this BTF: clang emits one BTF_KIND_VAR per extern with Linkage
+// "extern", grouped into a Datasec named ".extern".
+func (s *Spec) ExternNames() []string {
+	var names []string
+	for _, t := range s.byName[".extern"] {
+		ds, ok := t.(*Datasec)
+		if !ok {
+			continue
+		}
+		for _, v := range ds.Vars {
+			names = append(names, v.Name())
+		}
+	}
+	return names
+}
+
+// parseBTFHeader reads and validates the .BTF section header.
+func parseBTFHeader(data []byte, order binary.ByteOrder) (*btfHeader, []byte, error) {
+	if len(data) < 8 {
+		return nil, nil, errors.New("BTF data shorter than header")
+	}
+
+	var hdr btfHeader
+	if err := binary.Read(bytes.NewReader(data), order, &hdr); err != nil {
+		return nil, nil, errors.Wrap(err, "reading BTF header")
+	}
+	if hdr.Magic != btfMagic {
+		return nil, nil, fmt.Errorf("unexpected BTF magic 0x%x", hdr.Magic)
+	}
+	if int(hdr.HdrLen) > len(data) {
+		return nil, nil, errors.New("BTF header length exceeds section size")
+	}
+
+	return &hdr, data[hdr.HdrLen:], nil
+}
+
+// loadSpecFromELF parses the .BTF and .BTF.ext sections of an ELF file
+// into a Spec, resolving CO-RE relocations against the local types.
+func loadSpecFromELF(f *elf.File) (*Spec, error) {
+	btfSection := f.Section(".BTF")
+	if btfSection == nil {
+		return nil, nil
+	}
+
+	data, err := btfSection.Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading .BTF section")
+	}
+
+	spec, err := parseTypes(data, f.ByteOrder)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing BTF types")
+	}
+
+	if extSection := f.Section(".BTF.ext"); extSection != nil {
+		extData, err := extSection.Data()
+		if err != nil {
+			return nil, errors.Wrap(err, "reading .BTF.ext section")
+		}
+
+		relocs, err := parseCORERelocations(extData, f.ByteOrder, spec)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing CO-RE relocations")
+		}
+		spec.relocsBySection = relocs
+	}
+
+	return spec, nil
+}
+
+// LoadSpecFromReader parses the BTF contained in an ELF object.
+func LoadSpecFromReader(f *elf.File) (*Spec, error) {
+	return loadSpecFromELF(f)
+}
@@ -0,0 +1,403 @@
+package btf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReloKind identifies what a CORERelocation computes: a field's byte
+// offset, whether a field/type exists at all on the target kernel, a
+// field or type's size, whether an integer field is signed, or an enum
+// value's numeric value/existence.
+type ReloKind int
+
+const (
+	ReloFieldByteOffset ReloKind = iota
+	ReloFieldByteSize
+	ReloFieldExists
+	ReloFieldSigned
+	ReloTypeIDLocal
+	ReloTypeIDTarget
+	ReloTypeExists
+	ReloTypeSize
+	ReloEnumvalExists
+	ReloEnumvalValue
+)
+
+// CORERelocation describes a single compile-once-run-everywhere fixup:
+// the accessor spec identifies a field or type by walking Local's type
+// graph (e.g. "0:1:2" means "member 2 of member 1 of the 0th access of
+// Local"), and InsnOff is the byte offset of the ldimm64/alu instruction
+// in the program that embeds the locally-computed value to be patched.
+type CORERelocation struct {
+	InsnOff  uint32
+	Local    Type
+	Accessor []int
+	Kind     ReloKind
+}
+
+// parseCORERelocations decodes the CO-RE relocation records from a
+// .BTF.ext section, keyed by the ELF section (i.e. program) they apply
+// to. The func info and line info sub-sections are skipped.
+func parseCORERelocations(data []byte, order binary.ByteOrder, local *Spec) (map[string][]CORERelocation, error) {
+	// The .BTF.ext layout is: an 8-byte common header followed by the
+	// offsets/lengths of three sub-sections (func info, line info, core
+	// relo info), each of which is itself a sequence of per-section
+	// records prefixed by a record size and a name.
+	const headerLen = 8
+	if len(data) < headerLen+4*6 {
+		return nil, errors.New(".BTF.ext data shorter than header")
+	}
+
+	var hdr struct {
+		Magic   uint16
+		Version uint8
+		Flags   uint8
+		HdrLen  uint32
+
+		FuncInfoOff uint32
+		FuncInfoLen uint32
+		LineInfoOff uint32
+		LineInfoLen uint32
+		CoreRelOff  uint32
+		CoreRelLen  uint32
+	}
+	r := newByteReader(data)
+	if err := binary.Read(r, order, &hdr); err != nil {
+		return nil, errors.Wrap(err, "reading .BTF.ext header")
+	}
+
+	if int(hdr.HdrLen) > len(data) {
+		return nil, errors.New(".BTF.ext header length exceeds section size")
+	}
+	body := data[hdr.HdrLen:]
+
+	if int(hdr.CoreRelOff+hdr.CoreRelLen) > len(body) {
+		return nil, errors.New("core_relo section out of bounds")
+	}
+	relData := body[hdr.CoreRelOff : hdr.CoreRelOff+hdr.CoreRelLen]
+
+	relocs := make(map[string][]CORERelocation)
+
+	rr := newByteReader(relData)
+	var recordSize uint32
+	if err := binary.Read(rr, order, &recordSize); err != nil {
+		return nil, errors.Wrap(err, "reading core_relo record size")
+	}
+
+	for rr.Len() > 0 {
+		var sec struct {
+			SecNameOff uint32
+			NumRecords uint32
+		}
+		if err := binary.Read(rr, order, &sec); err != nil {
+			return nil, errors.Wrap(err, "reading core_relo section header")
+		}
+
+		secName := local.stringAt(sec.SecNameOff)
+
+		for i := uint32(0); i < sec.NumRecords; i++ {
+			var rec struct {
+				InsnOff   uint32
+				TypeID    uint32
+				AccessOff uint32
+				Kind      uint32
+			}
+			if err := binary.Read(rr, order, &rec); err != nil {
+				return nil, errors.Wrap(err, "reading core_relo record")
+			}
+
+			accessor, err := parseAccessor(local.stringAt(rec.AccessOff))
+			if err != nil {
+				return nil, errors.Wrapf(err, "section %s", secName)
+			}
+
+			var localType Type
+			if int(rec.TypeID) < len(local.types) {
+				localType = local.types[rec.TypeID]
+			}
+
+			relocs[secName] = append(relocs[secName], CORERelocation{
+				InsnOff:  rec.InsnOff,
+				Local:    localType,
+				Accessor: accessor,
+				Kind:     ReloKind(rec.Kind),
+			})
+		}
+	}
+
+	return relocs, nil
+}
+
+// parseAccessor splits a CO-RE accessor string like "0:1:2" into its
+// integer components.
+func parseAccessor(spec string) ([]int, error) {
+	parts := strings.Split(spec, ":")
+	out := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid accessor %q: %w", spec, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// CORERelocations returns the relocations that apply to the program in
+// the named ELF section.
+func (s *Spec) CORERelocations(secName string) []CORERelocation {
+	return s.relocsBySection[secName]
+}
+
+// Resolve walks relo.Accessor through relo.Local to find the matching
+// member in target, and returns the value that should replace the
+// locally-computed immediate for relo.Kind.
+func (relo *CORERelocation) Resolve(target *Spec) (int64, error) {
+	switch relo.Kind {
+	case ReloFieldByteOffset:
+		member, err := findMember(relo.Local, target, relo.Accessor)
+		if err != nil {
+			return 0, err
+		}
+		return int64(member.OffsetBits / 8), nil
+	case ReloFieldExists:
+		_, err := findMember(relo.Local, target, relo.Accessor)
+		if err != nil {
+			return 0, nil
+		}
+		return 1, nil
+	case ReloTypeExists:
+		if len(target.TypeByName(relo.Local.Name())) > 0 {
+			return 1, nil
+		}
+		return 0, nil
+	case ReloFieldByteSize:
+		member, err := findMember(relo.Local, target, relo.Accessor)
+		if err != nil {
+			return 0, err
+		}
+		size, err := typeSize(member.Type)
+		if err != nil {
+			return 0, err
+		}
+		return int64(size), nil
+	case ReloTypeSize:
+		candidates := target.TypeByName(relo.Local.Name())
+		if len(candidates) == 0 {
+			return 0, fmt.Errorf("type %s not found on target", relo.Local.Name())
+		}
+		size, err := typeSize(candidates[0])
+		if err != nil {
+			return 0, err
+		}
+		return int64(size), nil
+	case ReloFieldSigned:
+		member, err := findMember(relo.Local, target, relo.Accessor)
+		if err != nil {
+			return 0, err
+		}
+		if isSignedInt(member.Type) {
+			return 1, nil
+		}
+		return 0, nil
+	case ReloTypeIDLocal:
+		// The local id is whatever id clang assigned relo.Local within
+		// the compiled object's own BTF; it doesn't depend on target at
+		// all.
+		return int64(relo.Local.id()), nil
+	case ReloTypeIDTarget:
+		candidates := target.TypeByName(relo.Local.Name())
+		if len(candidates) == 0 {
+			return 0, fmt.Errorf("type %s not found on target", relo.Local.Name())
+		}
+		return int64(candidates[0].id()), nil
+	case ReloEnumvalExists, ReloEnumvalValue:
+		// Enum stores its enumerators as a name->value map rather than
+		// the ordered list BTF itself encodes, so the accessor's
+		// ordinal enumerator index can't be resolved to a name here.
+		// Treat as "doesn't exist" rather than aborting the whole
+		// collection.
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unsupported CO-RE relocation kind %d", relo.Kind)
+	}
+}
+
+// isSignedInt reports whether t is (or resolves through typedefs and
+// qualifiers to) a signed Int.
+func isSignedInt(t Type) bool {
+	switch v := t.(type) {
+	case *Int:
+		return v.Signed
+	case *Typedef:
+		return isSignedInt(v.Type)
+	case *Const:
+		return isSignedInt(v.Type)
+	case *Volatile:
+		return isSignedInt(v.Type)
+	case *Restrict:
+		return isSignedInt(v.Type)
+	default:
+		return false
+	}
+}
+
+// typeSize returns the size in bytes of t, resolving through typedefs
+// and qualifiers.
+func typeSize(t Type) (uint32, error) {
+	switch v := t.(type) {
+	case *Int:
+		return v.Size, nil
+	case *Struct:
+		return v.Size, nil
+	case *Union:
+		return v.Size, nil
+	case *Enum:
+		return 4, nil
+	case *Pointer:
+		return 8, nil
+	case *Array:
+		elemSize, err := typeSize(v.Type)
+		if err != nil {
+			return 0, err
+		}
+		return elemSize * v.Nelems, nil
+	case *Typedef:
+		return typeSize(v.Type)
+	case *Const:
+		return typeSize(v.Type)
+	case *Volatile:
+		return typeSize(v.Type)
+	case *Restrict:
+		return typeSize(v.Type)
+	default:
+		return 0, fmt.Errorf("don't know the size of %T", t)
+	}
+}
+
+// findMember walks accessor (a chain of member indices, as encoded by
+// clang's access string, e.g. "0:1:2": member 2 of member 1's type,
+// within the 0th access of Local) starting from local's definition, and
+// returns the equivalently-named member chain as laid out in target,
+// with OffsetBits accumulated across every nesting level it passes
+// through. Members are matched by name at each level, not by position
+// or offset: this is what lets the same relocation
+// apply against kernels whose struct layouts differ from the one the
+// program was compiled against.
+func findMember(local Type, target *Spec, accessor []int) (*Member, error) {
+	if len(accessor) < 2 {
+		return nil, errors.New("accessor too short to name a member")
+	}
+
+	localRoot := unwrapComposite(local)
+	if localRoot == nil {
+		return nil, fmt.Errorf("%s is not a struct or union", local.Name())
+	}
+
+	var lastErr error
+	for _, candidate := range target.TypeByName(local.Name()) {
+		targetRoot := unwrapComposite(candidate)
+		if targetRoot == nil {
+			continue
+		}
+
+		member, err := walkMemberChain(localRoot, targetRoot, accessor[1:])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return member, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("no type named %s found on target", local.Name())
+}
+
+// walkMemberChain descends idxs (positional member indices into local)
+// one level at a time, matching each local member against a
+// same-named member of target, and sums bit offsets across every
+// level. The returned Member's OffsetBits is relative to the outermost
+// target type passed to findMember.
+func walkMemberChain(localType, targetType Type, idxs []int) (*Member, error) {
+	if len(idxs) == 0 {
+		return nil, errors.New("empty member chain")
+	}
+
+	idx := idxs[0]
+	locals := localMembers(localType)
+	if idx < 0 || idx >= len(locals) {
+		return nil, fmt.Errorf("member index %d out of range for %s", idx, localType.Name())
+	}
+	localMember := locals[idx]
+
+	var targetMember *Member
+	for i, m := range localMembers(targetType) {
+		if m.Name == localMember.Name {
+			targetMember = &localMembers(targetType)[i]
+			break
+		}
+	}
+	if targetMember == nil {
+		return nil, fmt.Errorf("no member %q found on target type %s", localMember.Name, targetType.Name())
+	}
+
+	if len(idxs) == 1 {
+		return &Member{
+			Name:         targetMember.Name,
+			Type:         targetMember.Type,
+			OffsetBits:   targetMember.OffsetBits,
+			BitfieldSize: targetMember.BitfieldSize,
+		}, nil
+	}
+
+	nextLocal := unwrapComposite(localMember.Type)
+	nextTarget := unwrapComposite(targetMember.Type)
+	if nextLocal == nil || nextTarget == nil {
+		return nil, fmt.Errorf("cannot descend into non-composite member %q", localMember.Name)
+	}
+
+	rest, err := walkMemberChain(nextLocal, nextTarget, idxs[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Member{
+		Name:         rest.Name,
+		Type:         rest.Type,
+		OffsetBits:   targetMember.OffsetBits + rest.OffsetBits,
+		BitfieldSize: rest.BitfieldSize,
+	}, nil
+}
+
+func unwrapComposite(t Type) Type {
+	switch v := t.(type) {
+	case *Struct, *Union:
+		return v.(Type)
+	case *Typedef:
+		return unwrapComposite(v.Type)
+	case *Const:
+		return unwrapComposite(v.Type)
+	case *Volatile:
+		return unwrapComposite(v.Type)
+	default:
+		return nil
+	}
+}
+
+func localMembers(t Type) []Member {
+	switch v := t.(type) {
+	case *Struct:
+		return v.Members
+	case *Union:
+		return v.Members
+	default:
+		return nil
+	}
+}
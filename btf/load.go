@@ -0,0 +1,61 @@
+package btf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// hostByteOrder returns the byte order of the running machine. The
+// kernel always exports vmlinux BTF in host order.
+func hostByteOrder() binary.ByteOrder {
+	var x uint16 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+const kernelBTFPath = "/sys/kernel/btf/vmlinux"
+
+// LoadKernelSpec parses the running kernel's BTF, which the kernel
+// exposes in raw (non-ELF) form at /sys/kernel/btf/vmlinux.
+func LoadKernelSpec() (*Spec, error) {
+	f, err := os.Open(kernelBTFPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening kernel BTF")
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading kernel BTF")
+	}
+
+	spec, err := parseTypes(data, hostByteOrder())
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing kernel BTF")
+	}
+	return spec, nil
+}
+
+func newByteReader(b []byte) *bytes.Reader {
+	return bytes.NewReader(b)
+}
+
+// LoadSpecFromELFFile is a convenience wrapper around LoadSpecFromReader
+// that opens path itself.
+func LoadSpecFromELFFile(path string) (*Spec, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadSpecFromReader(f)
+}
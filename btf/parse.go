@@ -0,0 +1,305 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// btfType is the fixed-size, on-disk encoding of a single BTF type. The
+// variable-length data that follows it (members, params, ...) depends on
+// Kind and is parsed separately.
+type btfType struct {
+	NameOff    uint32
+	Info       uint32
+	SizeOrType uint32
+}
+
+func (t *btfType) kind() uint8    { return uint8((t.Info >> 24) & 0x1f) }
+func (t *btfType) vlen() int      { return int(t.Info & 0xffff) }
+func (t *btfType) kindFlag() bool { return t.Info&(1<<31) != 0 }
+
+const (
+	kindInt = iota + 1
+	kindPtr
+	kindArray
+	kindStruct
+	kindUnion
+	kindEnum
+	kindFwd
+	kindTypedef
+	kindVolatile
+	kindConst
+	kindRestrict
+	kindFunc
+	kindFuncProto
+	kindVar
+	kindDatasec
+)
+
+// parseTypes decodes the type and string sub-sections of a .BTF section
+// and links references (Pointer.Target, Struct.Members[i].Type, ...)
+// between the resulting Types.
+func parseTypes(data []byte, order binary.ByteOrder) (*Spec, error) {
+	hdr, rest, err := parseBTFHeader(data, order)
+	if err != nil {
+		return nil, err
+	}
+
+	if int(hdr.StrOff+hdr.StrLen) > len(rest) {
+		return nil, errors.New("string section out of bounds")
+	}
+	strings := rest[hdr.StrOff : hdr.StrOff+hdr.StrLen]
+
+	if int(hdr.TypeOff+hdr.TypeLen) > len(rest) {
+		return nil, errors.New("type section out of bounds")
+	}
+	typeData := rest[hdr.TypeOff : hdr.TypeOff+hdr.TypeLen]
+
+	str := func(off uint32) string {
+		end := bytes.IndexByte(strings[off:], 0)
+		if end < 0 {
+			return ""
+		}
+		return string(strings[off : off+uint32(end)])
+	}
+
+	// Type ID 0 is implicitly Void.
+	types := []Type{&Void{typeBase{ID: 0}}}
+
+	// References between types (Pointer.Target, Struct member types, ...)
+	// are only stored as raw type ids during this pass, since the
+	// referenced id may not have been parsed yet (BTF allows forward
+	// references). They are linked up into real Type values in the
+	// second pass below, once every id has a Type.
+	singleRefs := make(map[TypeID]uint32)      // Pointer/Typedef/Volatile/Const/Restrict/Var
+	memberRefs := make(map[TypeID][]uint32)    // Struct/Union, one id per member
+	arrayRefs := make(map[TypeID][2]uint32)    // {Type, Index}
+	funcProtoRefs := make(map[TypeID][]uint32) // one id per param
+	datasecRefs := make(map[TypeID][]uint32)   // one id per var
+
+	r := bytes.NewReader(typeData)
+	for id := TypeID(1); r.Len() > 0; id++ {
+		var raw btfType
+		if err := binary.Read(r, order, &raw); err != nil {
+			return nil, errors.Wrapf(err, "type id %d", id)
+		}
+
+		base := typeBase{TypeName: str(raw.NameOff), ID: id}
+
+		var t Type
+		switch raw.kind() {
+		case kindInt:
+			var extra uint32
+			if err := binary.Read(r, order, &extra); err != nil {
+				return nil, err
+			}
+			t = &Int{typeBase: base, Size: raw.SizeOrType, Signed: extra&0x01000000 != 0}
+		case kindPtr, kindTypedef, kindVolatile, kindConst, kindRestrict:
+			singleRefs[id] = raw.SizeOrType
+			switch raw.kind() {
+			case kindPtr:
+				t = &Pointer{typeBase: base}
+			case kindTypedef:
+				t = &Typedef{typeBase: base}
+			case kindVolatile:
+				t = &Volatile{typeBase: base}
+			case kindConst:
+				t = &Const{typeBase: base}
+			case kindRestrict:
+				t = &Restrict{typeBase: base}
+			}
+		case kindStruct, kindUnion:
+			members := make([]Member, raw.vlen())
+			memberTypeIDs := make([]uint32, raw.vlen())
+			for i := range members {
+				var m struct {
+					NameOff uint32
+					Type    uint32
+					Offset  uint32
+				}
+				if err := binary.Read(r, order, &m); err != nil {
+					return nil, err
+				}
+				members[i] = Member{
+					Name:       str(m.NameOff),
+					OffsetBits: m.Offset & 0xffffff,
+				}
+				if raw.kindFlag() {
+					members[i].BitfieldSize = m.Offset >> 24
+				}
+				memberTypeIDs[i] = m.Type
+			}
+			memberRefs[id] = memberTypeIDs
+			if raw.kind() == kindStruct {
+				t = &Struct{typeBase: base, Size: raw.SizeOrType, Members: members}
+			} else {
+				t = &Union{typeBase: base, Size: raw.SizeOrType, Members: members}
+			}
+		case kindEnum:
+			values := make(map[string]int32, raw.vlen())
+			for i := 0; i < raw.vlen(); i++ {
+				var e struct {
+					NameOff uint32
+					Val     int32
+				}
+				if err := binary.Read(r, order, &e); err != nil {
+					return nil, err
+				}
+				values[str(e.NameOff)] = e.Val
+			}
+			t = &Enum{typeBase: base, Values: values}
+		case kindFwd:
+			kind := "struct"
+			if raw.kindFlag() {
+				kind = "union"
+			}
+			t = &Fwd{typeBase: base, Kind: kind}
+		case kindArray:
+			var a struct {
+				Type   uint32
+				Index  uint32
+				Nelems uint32
+			}
+			if err := binary.Read(r, order, &a); err != nil {
+				return nil, err
+			}
+			arrayRefs[id] = [2]uint32{a.Type, a.Index}
+			t = &Array{typeBase: base, Nelems: a.Nelems}
+		case kindFuncProto:
+			params := make([]FuncParam, raw.vlen())
+			paramTypeIDs := make([]uint32, raw.vlen())
+			for i := range params {
+				var p struct {
+					NameOff uint32
+					Type    uint32
+				}
+				if err := binary.Read(r, order, &p); err != nil {
+					return nil, err
+				}
+				params[i] = FuncParam{Name: str(p.NameOff)}
+				paramTypeIDs[i] = p.Type
+			}
+			funcProtoRefs[id] = paramTypeIDs
+			singleRefs[id] = raw.SizeOrType // return type
+			t = &FuncProto{typeBase: base, Params: params}
+		case kindVar:
+			var v struct{ Linkage uint32 }
+			if err := binary.Read(r, order, &v); err != nil {
+				return nil, err
+			}
+			linkage := "static"
+			if v.Linkage == 1 {
+				linkage = "global"
+			} else if v.Linkage == 2 {
+				linkage = "extern"
+			}
+			singleRefs[id] = raw.SizeOrType
+			t = &Var{typeBase: base, Linkage: linkage}
+		case kindDatasec:
+			vars := make([]Var, raw.vlen())
+			varTypeIDs := make([]uint32, raw.vlen())
+			for i := range vars {
+				var d struct {
+					Type   uint32
+					Offset uint32
+					Size   uint32
+				}
+				if err := binary.Read(r, order, &d); err != nil {
+					return nil, err
+				}
+				varTypeIDs[i] = d.Type
+			}
+			datasecRefs[id] = varTypeIDs
+			t = &Datasec{typeBase: base, Size: raw.SizeOrType, Vars: vars}
+		default:
+			t = &typeBaseWrapper{typeBase: base}
+		}
+
+		types = append(types, t)
+	}
+
+	resolve := func(ref uint32) Type {
+		if int(ref) < len(types) {
+			return types[ref]
+		}
+		return nil
+	}
+
+	// Second pass: link every stored type-id reference into the Type it
+	// names, now that every id in this Spec has a Type.
+	for id, targetID := range singleRefs {
+		target := resolve(targetID)
+		switch v := types[id].(type) {
+		case *Pointer:
+			v.Target = target
+		case *Typedef:
+			v.Type = target
+		case *Volatile:
+			v.Type = target
+		case *Const:
+			v.Type = target
+		case *Restrict:
+			v.Type = target
+		case *FuncProto:
+			v.Return = target
+		case *Var:
+			v.Type = target
+		}
+	}
+	for id, memberTypeIDs := range memberRefs {
+		switch v := types[id].(type) {
+		case *Struct:
+			for i, typeID := range memberTypeIDs {
+				v.Members[i].Type = resolve(typeID)
+			}
+		case *Union:
+			for i, typeID := range memberTypeIDs {
+				v.Members[i].Type = resolve(typeID)
+			}
+		}
+	}
+	for id, refs := range arrayRefs {
+		if a, ok := types[id].(*Array); ok {
+			a.Type = resolve(refs[0])
+			a.Index = resolve(refs[1])
+		}
+	}
+	for id, paramTypeIDs := range funcProtoRefs {
+		if fp, ok := types[id].(*FuncProto); ok {
+			for i, typeID := range paramTypeIDs {
+				fp.Params[i].Type = resolve(typeID)
+			}
+		}
+	}
+	for id, varTypeIDs := range datasecRefs {
+		if ds, ok := types[id].(*Datasec); ok {
+			for i, typeID := range varTypeIDs {
+				// Each datasec entry refers to a BTF_KIND_VAR, which
+				// carries the variable's name, type and linkage.
+				if v, ok := resolve(typeID).(*Var); ok {
+					ds.Vars[i] = *v
+				} else {
+					ds.Vars[i].Type = resolve(typeID)
+				}
+			}
+		}
+	}
+
+	byName := make(map[string][]Type)
+	for _, t := range types {
+		if t.Name() != "" {
+			byName[t.Name()] = append(byName[t.Name()], t)
+		}
+	}
+
+	return &Spec{types: types, byName: byName, strings: strings}, nil
+}
+
+// typeBaseWrapper is used for BTF kinds this package doesn't model in
+// detail (e.g. BTF_KIND_FUNC), so that type IDs referencing them still
+// resolve to something with a name.
+type typeBaseWrapper struct {
+	typeBase
+}
@@ -0,0 +1,128 @@
+package btf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildBTF assembles a minimal, well-formed .BTF blob: a header followed
+// by the type and string sub-sections.
+func buildBTF(t *testing.T, order binary.ByteOrder, types []byte, strs []byte) []byte {
+	t.Helper()
+
+	const hdrLen = 24
+	hdr := struct {
+		Magic   uint16
+		Version uint8
+		Flags   uint8
+		HdrLen  uint32
+		TypeOff uint32
+		TypeLen uint32
+		StrOff  uint32
+		StrLen  uint32
+	}{
+		Magic:   btfMagic,
+		HdrLen:  hdrLen,
+		TypeOff: 0,
+		TypeLen: uint32(len(types)),
+		StrOff:  uint32(len(types)),
+		StrLen:  uint32(len(strs)),
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, &hdr); err != nil {
+		t.Fatalf("writing header: %v", err)
+	}
+	buf.Write(types)
+	buf.Write(strs)
+	return buf.Bytes()
+}
+
+// TestParseTypesResolvesForwardReferences builds a BTF blob declaring a
+// Pointer (id 1) before its target Int (id 2), so the reference can only
+// be stored as a raw id and resolved after every type has been parsed,
+// and checks that the second pass links Pointer.Target to the actual Int
+// type.
+func TestParseTypesResolvesForwardReferences(t *testing.T) {
+	order := binary.LittleEndian
+
+	// String table: "\x00int\x00"
+	strs := append([]byte{0}, []byte("int\x00")...)
+	const intNameOff = 1
+
+	var types bytes.Buffer
+	// id 1: Pointer (anonymous) to id 2, which hasn't been parsed yet.
+	write(t, &types, order, btfType{NameOff: 0, Info: kindPtr << 24, SizeOrType: 2})
+
+	// id 2: Int "int", size 4, signed.
+	write(t, &types, order, btfType{NameOff: intNameOff, Info: kindInt << 24, SizeOrType: 4})
+	write(t, &types, order, uint32(0x01000000)) // signed encoding bit
+
+	data := buildBTF(t, order, types.Bytes(), strs)
+
+	spec, err := parseTypes(data, order)
+	if err != nil {
+		t.Fatalf("parseTypes: %v", err)
+	}
+
+	if len(spec.types) != 3 { // Void + Pointer + Int
+		t.Fatalf("got %d types, want 3", len(spec.types))
+	}
+
+	intType, ok := spec.types[2].(*Int)
+	if !ok {
+		t.Fatalf("type 2 is %T, want *Int", spec.types[2])
+	}
+	if intType.Name() != "int" || intType.Size != 4 || !intType.Signed {
+		t.Errorf("unexpected Int: %+v", intType)
+	}
+
+	ptr, ok := spec.types[1].(*Pointer)
+	if !ok {
+		t.Fatalf("type 1 is %T, want *Pointer", spec.types[1])
+	}
+	if ptr.Target != intType {
+		t.Errorf("Pointer.Target = %v, want the Int type (second pass didn't resolve the forward reference)", ptr.Target)
+	}
+}
+
+func write(t *testing.T, buf *bytes.Buffer, order binary.ByteOrder, v interface{}) {
+	t.Helper()
+	if err := binary.Write(buf, order, v); err != nil {
+		t.Fatalf("writing %T: %v", v, err)
+	}
+}
+
+func TestParseAccessor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{"0", []int{0}, false},
+		{"0:1:2", []int{0, 1, 2}, false},
+		{"", nil, true},
+		{"0:x", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAccessor(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseAccessor(%q): expected error, got %v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseAccessor(%q): %v", tt.in, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("parseAccessor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("parseAccessor(%q)[%d] = %d, want %d", tt.in, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
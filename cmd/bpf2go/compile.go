@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// target describes one of the two endianness variants bpf2go builds for.
+type target struct {
+	// suffix is used in the object/go file names (bpfel/bpfeb).
+	suffix string
+	// clang is the -target triple passed to the compiler.
+	clang string
+}
+
+var (
+	targetEL = target{suffix: "bpfel", clang: "bpfel"}
+	targetEB = target{suffix: "bpfeb", clang: "bpfeb"}
+)
+
+// goArches maps every GOARCH Go supports to the endianness suffix
+// (matching target.suffix) its generated code should build for. Two
+// GOARCH values can share a suffix (e.g. mips/mips64 are both "bpfeb"),
+// but every GOARCH that can compile this package must appear exactly
+// once so the two generated files' build tags are complements of each
+// other.
+var goArches = map[string]string{
+	"386":      "bpfel",
+	"amd64":    "bpfel",
+	"arm":      "bpfel",
+	"arm64":    "bpfel",
+	"loong64":  "bpfel",
+	"mipsle":   "bpfel",
+	"mips64le": "bpfel",
+	"ppc64le":  "bpfel",
+	"riscv64":  "bpfel",
+	"mips":     "bpfeb",
+	"mips64":   "bpfeb",
+	"ppc64":    "bpfeb",
+	"s390x":    "bpfeb",
+}
+
+// buildTag returns the //go:build constraint expression (e.g.
+// "386 || amd64 || arm || ...") selecting every GOARCH that matches t's
+// endianness, so that the bpfel and bpfeb variants of a generated file
+// never both build for the same architecture.
+func buildTag(t target) string {
+	var arches []string
+	for arch, suffix := range goArches {
+		if suffix == t.suffix {
+			arches = append(arches, arch)
+		}
+	}
+	sort.Strings(arches)
+	return strings.Join(arches, " || ")
+}
+
+// compile invokes cc to build cSources into a single BPF object file for
+// the given target.
+func compile(cc string, cSources []string, cFlags []string, t target, outFile string) error {
+	args := append([]string{
+		"-target", t.clang,
+		"-D__BPF_TRACING__",
+		"-Wall",
+		"-O2",
+		"-g",
+		"-c",
+		"-o", outFile,
+	}, cFlags...)
+	args = append(args, cSources...)
+
+	cmd := exec.Command(cc, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %v: %w\n%s", cc, args, err, out)
+	}
+	return nil
+}
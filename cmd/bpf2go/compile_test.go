@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildTag(t *testing.T) {
+	el := buildTag(targetEL)
+	eb := buildTag(targetEB)
+
+	if el == "" || eb == "" {
+		t.Fatalf("buildTag returned an empty constraint: el=%q eb=%q", el, eb)
+	}
+
+	elArches := strings.Split(el, " || ")
+	ebArches := strings.Split(eb, " || ")
+
+	for arch, suffix := range goArches {
+		var arches []string
+		switch suffix {
+		case "bpfel":
+			arches = elArches
+		case "bpfeb":
+			arches = ebArches
+		default:
+			t.Fatalf("goArches[%q] has unknown suffix %q", arch, suffix)
+		}
+		if !contains(arches, arch) {
+			t.Errorf("buildTag for suffix %q is missing arch %q", suffix, arch)
+		}
+	}
+
+	// The two constraints must never both match the same GOARCH.
+	for _, arch := range elArches {
+		if contains(ebArches, arch) {
+			t.Errorf("arch %q satisfies both bpfel and bpfeb build tags", arch)
+		}
+	}
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
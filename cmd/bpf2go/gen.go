@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/Gui774ume/ebpf"
+)
+
+type generateArgs struct {
+	pkg     string
+	ident   string
+	target  target
+	objFile string
+	outFile string
+}
+
+// field pairs a program/map's ELF section name with the exported Go
+// identifier it's addressed by in the generated struct.
+type field struct {
+	Name  string
+	Field string
+}
+
+// generate loads objFile as a CollectionSpec and renders a Go source file
+// declaring typed accessors for every program and map it contains, plus a
+// Load<Ident>Objects helper that loads the embedded bytecode and populates
+// them.
+func generate(args generateArgs) error {
+	spec, err := ebpf.LoadCollectionSpec(args.objFile)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", args.objFile, err)
+	}
+
+	var progNames, mapNames []string
+	for name := range spec.Programs {
+		progNames = append(progNames, name)
+	}
+	for name := range spec.Maps {
+		mapNames = append(mapNames, name)
+	}
+	sort.Strings(progNames)
+	sort.Strings(mapNames)
+
+	data := struct {
+		Package  string
+		Ident    string
+		GoIdent  string
+		ObjFile  string
+		BuildTag string
+		Programs []field
+		Maps     []field
+	}{
+		Package:  args.pkg,
+		Ident:    args.ident,
+		GoIdent:  exportedIdent(args.ident),
+		ObjFile:  filepath.Base(args.objFile),
+		BuildTag: buildTag(args.target),
+		Programs: fields(progNames),
+		Maps:     fields(mapNames),
+	}
+
+	var buf bytes.Buffer
+	if err := bindingsTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("executing template: %w", err)
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated source: %w\n%s", err, buf.String())
+	}
+
+	return ioutil.WriteFile(args.outFile, formatted, 0644)
+}
+
+func fields(names []string) []field {
+	fs := make([]field, len(names))
+	for i, name := range names {
+		fs[i] = field{Name: name, Field: exportedIdent(name)}
+	}
+	return fs
+}
+
+// exportedIdent turns a C/ELF identifier such as a section name
+// ("kprobe/sys_execve", "tracepoint__syscalls__sys_enter_execve") into a
+// valid, exported Go identifier by splitting on every run of characters
+// that can't appear in a Go identifier and capitalizing each piece.
+func exportedIdent(ident string) string {
+	var b strings.Builder
+	upperNext := true
+	for _, r := range ident {
+		isIdentRune := r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+		if !isIdentRune {
+			upperNext = true
+			continue
+		}
+		if upperNext {
+			r = unicode.ToUpper(r)
+			upperNext = false
+		}
+		b.WriteRune(r)
+	}
+
+	out := b.String()
+	if out == "" {
+		return "_"
+	}
+	if out[0] >= '0' && out[0] <= '9' {
+		out = "_" + out
+	}
+	return out
+}
+
+var bindingsTemplate = template.Must(template.New("bindings").Parse(`// Code generated by bpf2go; DO NOT EDIT.
+
+//go:build {{ .BuildTag }}
+// +build {{ .BuildTag }}
+
+package {{ .Package }}
+
+import (
+	"bytes"
+	_ "embed"
+
+	"github.com/Gui774ume/ebpf"
+)
+
+//go:embed {{ .ObjFile }}
+var _{{ .Ident }}Bytes []byte
+
+// {{ .GoIdent }}Programs contains all programs of {{ .Ident }}, keyed by
+// section name.
+type {{ .GoIdent }}Programs struct {
+{{- range .Programs }}
+	{{ .Field }} *ebpf.Program
+{{- end }}
+}
+
+// {{ .GoIdent }}Maps contains all maps of {{ .Ident }}, keyed by section
+// name.
+type {{ .GoIdent }}Maps struct {
+{{- range .Maps }}
+	{{ .Field }} *ebpf.Map
+{{- end }}
+}
+
+// {{ .GoIdent }}Objects contains all programs and maps of {{ .Ident }}.
+type {{ .GoIdent }}Objects struct {
+	{{ .GoIdent }}Programs
+	{{ .GoIdent }}Maps
+}
+
+// Close closes every Program and Map in the collection.
+func (o *{{ .GoIdent }}Objects) Close() []error {
+	var errs []error
+{{- range .Programs }}
+	if o.{{ .Field }} != nil {
+		if err := o.{{ .Field }}.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+{{- end }}
+{{- range .Maps }}
+	if o.{{ .Field }} != nil {
+		if err := o.{{ .Field }}.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+{{- end }}
+	return errs
+}
+
+// Load{{ .GoIdent }}Objects loads {{ .Ident }} and populates obj according
+// to the section names of its fields.
+func Load{{ .GoIdent }}Objects(obj *{{ .GoIdent }}Objects, opts ebpf.CollectionOptions) error {
+	spec, err := ebpf.LoadCollectionSpecFromReader(bytes.NewReader(_{{ .Ident }}Bytes))
+	if err != nil {
+		return err
+	}
+
+	coll, err := ebpf.NewCollectionWithOptions(spec, opts)
+	if err != nil {
+		return err
+	}
+
+{{- range .Programs }}
+	obj.{{ .Field }} = coll.Programs["{{ .Name }}"]
+{{- end }}
+{{- range .Maps }}
+	obj.{{ .Field }} = coll.Maps["{{ .Name }}"]
+{{- end }}
+
+	return nil
+}
+`))
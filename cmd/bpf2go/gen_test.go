@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestExportedIdent(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "_"},
+		{"foo", "Foo"},
+		{"kprobe/foo", "KprobeFoo"},
+		{"tracepoint/syscalls/sys_enter_execve", "TracepointSyscallsSys_enter_execve"},
+		{"xdp-ingress", "XdpIngress"},
+		{"2fast", "_2fast"},
+		{"__bss", "__bss"},
+	}
+	for _, tt := range tests {
+		if got := exportedIdent(tt.in); got != tt.want {
+			t.Errorf("exportedIdent(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	got := fields([]string{"kprobe/foo", "my_map"})
+	want := []field{
+		{Name: "kprobe/foo", Field: "KprobeFoo"},
+		{Name: "my_map", Field: "My_map"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("fields() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("fields()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
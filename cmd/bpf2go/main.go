@@ -0,0 +1,86 @@
+// Command bpf2go compiles a set of C sources into eBPF bytecode and emits
+// typed Go bindings for the resulting Collection.
+//
+// The generated file embeds the compiled object so that programs using it
+// do not need to ship the .o file (or a copy of libbpf/libelf) alongside
+// the Go binary.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "bpf2go:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("bpf2go", flag.ExitOnError)
+	var (
+		ident      = fs.String("ident", "", "identifier used for generated types, e.g. 'bpf' produces bpfObjects")
+		pkg        = fs.String("pkg", "", "Go package name for the generated file (defaults to the current directory name)")
+		outDir     = fs.String("output-dir", ".", "directory the generated Go file and object files are written to")
+		cc         = fs.String("cc", "clang", "compiler to invoke for building the object files")
+		cFlagsJoin = fs.String("cflags", "", "extra flags passed to the compiler, space separated")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cSources := fs.Args()
+	if len(cSources) == 0 {
+		return fmt.Errorf("expected at least one C source file")
+	}
+
+	if *ident == "" {
+		return fmt.Errorf("-ident is required")
+	}
+
+	if *pkg == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		*pkg = filepath.Base(wd)
+	}
+
+	var cFlags []string
+	if *cFlagsJoin != "" {
+		cFlags = splitFields(*cFlagsJoin)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	for _, target := range []target{targetEL, targetEB} {
+		objFile := filepath.Join(*outDir, fmt.Sprintf("%s_%s.o", *ident, target.suffix))
+		if err := compile(*cc, cSources, cFlags, target, objFile); err != nil {
+			return fmt.Errorf("compiling for %s: %w", target.suffix, err)
+		}
+
+		goFile := filepath.Join(*outDir, fmt.Sprintf("%s_%s.go", *ident, target.suffix))
+		if err := generate(generateArgs{
+			pkg:     *pkg,
+			ident:   *ident,
+			target:  target,
+			objFile: objFile,
+			outFile: goFile,
+		}); err != nil {
+			return fmt.Errorf("generating bindings for %s: %w", target.suffix, err)
+		}
+	}
+
+	return nil
+}
+
+func splitFields(s string) []string {
+	return strings.Fields(s)
+}
@@ -1,22 +1,64 @@
 package ebpf
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/Gui774ume/ebpf/btf"
 )
 
 // CollectionOptions control loading a collection into the kernel.
 type CollectionOptions struct {
 	Programs ProgramOptions
+
+	// PinPath is the bpffs directory that maps and programs declaring a
+	// PinPath in their spec (LIBBPF_PIN_BY_NAME in the ELF map/program
+	// definition) are auto-pinned under, as filepath.Join(PinPath,
+	// spec.PinPath). A map or program already pinned at that path is
+	// reused instead of being recreated, so that independent
+	// Collections can share state through a named map or program. Maps
+	// and programs without a PinPath are unaffected.
+	PinPath string
+
+	// KernelTypes is the BTF of the kernel the collection is loaded
+	// against. It is used to resolve CO-RE relocations so that a single
+	// object file can run unmodified on kernels whose struct layouts
+	// differ from the one it was compiled against. If nil and the
+	// collection's programs carry CO-RE relocations, it is loaded from
+	// /sys/kernel/btf/vmlinux on demand.
+	KernelTypes *btf.Spec
+
+	// MapReplacements satisfies a program's `extern` map references
+	// (declared in the ELF as extern map definitions and BTF_KIND_VAR
+	// entries in .extern) by symbol name, taking precedence over
+	// Externs. This lets several object files that share global maps be
+	// composed: one collection defines the maps, later collections
+	// declare them extern and link against them here.
+	MapReplacements map[string]*Map
+
+	// Externs is consulted for any `extern` map symbol not satisfied by
+	// MapReplacements. It should return an error for symbols it doesn't
+	// recognize; a nil Map with a nil error is treated as "not found".
+	Externs func(name string) (*Map, error)
 }
 
 // CollectionSpec describes a collection.
 type CollectionSpec struct {
 	Maps     map[string]*MapSpec
 	Programs map[string]*ProgramSpec
+
+	// BTF holds the collection's own BTF, as parsed from the object
+	// file's .BTF/.BTF.ext sections by btf.LoadSpecFromReader. CO-RE
+	// relocations and extern declarations are read from it.
+	// LoadCollectionSpec and LoadCollectionSpecFromReader do not set it:
+	// it is nil unless the caller fills it in.
+	BTF *btf.Spec
 }
 
 // Copy returns a recursive copy of the spec.
@@ -57,6 +99,47 @@ func LoadCollectionSpec(file string) (*CollectionSpec, error) {
 type Collection struct {
 	Programs map[string]*Program
 	Maps     map[string]*Map
+
+	// mapPinPaths carries each map's spec-declared PinPath (relative to
+	// the options' PinPath at load time), so that Pin can lay pinned
+	// maps out the same way regardless of the directory Pin is later
+	// called with.
+	mapPinPaths map[string]string
+
+	// progPinPaths mirrors mapPinPaths for programs.
+	progPinPaths map[string]string
+
+	// externs holds the names of the `extern` map symbols declared by
+	// the spec's BTF, as returned by Externs.
+	externs []string
+
+	// attachments tracks hooks installed by the Attach*/Enable* family
+	// of methods (XDP, TC, uprobes, perf events, socket filters, LSM,
+	// raw tracepoints), keyed by section name, so that Close can tear
+	// them down without callers having to bypass the Collection.
+	attachments map[string]io.Closer
+}
+
+// attach records a hook so that Close tears it down, replacing any
+// previous hook attached under the same section name.
+func (coll *Collection) attach(secName string, closer io.Closer) {
+	if coll.attachments == nil {
+		coll.attachments = make(map[string]io.Closer)
+	}
+	if prev, ok := coll.attachments[secName]; ok {
+		prev.Close()
+	}
+	coll.attachments[secName] = closer
+}
+
+// detach removes and closes the hook attached under secName, if any.
+func (coll *Collection) detach(secName string) error {
+	closer, ok := coll.attachments[secName]
+	if !ok {
+		return nil
+	}
+	delete(coll.attachments, secName)
+	return closer.Close()
 }
 
 // NewCollection creates a Collection from a specification.
@@ -71,24 +154,70 @@ func NewCollection(spec *CollectionSpec) (*Collection, error) {
 // Only maps referenced by at least one of the programs are initialized.
 func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Collection, error) {
 	maps := make(map[string]*Map)
+	mapPinPaths := make(map[string]string)
 	for mapName, mapSpec := range spec.Maps {
-		m, err := NewMap(mapSpec)
+		m, err := newMapWithPin(mapSpec, opts.PinPath)
 		if err != nil {
 			return nil, errors.Wrapf(err, "map %s", mapName)
 		}
 		maps[mapName] = m
+		if mapSpec.PinPath != "" {
+			mapPinPaths[mapName] = mapSpec.PinPath
+		}
+	}
+
+	var kernelTypes *btf.Spec
+	if spec.BTF != nil {
+		kernelTypes = opts.KernelTypes
+		needsKernelTypes := false
+		for _, progSpec := range spec.Programs {
+			if len(spec.BTF.CORERelocations(progSpec.SectionName)) > 0 {
+				needsKernelTypes = true
+				break
+			}
+		}
+		if kernelTypes == nil && needsKernelTypes {
+			loaded, err := btf.LoadKernelSpec()
+			if err != nil {
+				return nil, errors.Wrap(err, "loading kernel BTF")
+			}
+			kernelTypes = loaded
+		}
+	}
+
+	var expectedExterns map[string]bool
+	if spec.BTF != nil {
+		expectedExterns = make(map[string]bool)
+		for _, name := range spec.BTF.ExternNames() {
+			expectedExterns[name] = true
+		}
 	}
 
 	progs := make(map[string]*Program)
+	progPinPaths := make(map[string]string)
+	var unresolved []string
 	for progName, origProgSpec := range spec.Programs {
 		progSpec := origProgSpec.Copy()
+
+		if spec.BTF != nil {
+			if err := applyCORERelocations(progSpec, spec.BTF.CORERelocations(progSpec.SectionName), kernelTypes); err != nil {
+				return nil, errors.Wrapf(err, "program %s", progName)
+			}
+		}
+
 		editor := Edit(&progSpec.Instructions)
 
 		// Rewrite any Symbol which is a valid Map.
 		for sym := range editor.ReferenceOffsets {
 			m, ok := maps[sym]
 			if !ok {
-				continue
+				m, ok = resolveExtern(sym, opts)
+				if !ok {
+					if expectedExterns[sym] {
+						unresolved = append(unresolved, sym)
+					}
+					continue
+				}
 			}
 
 			// don't overwrite maps already rewritten, users can rewrite programs in the spec themselves
@@ -97,19 +226,60 @@ func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Co
 			}
 		}
 
-		prog, err := NewProgramWithOptions(progSpec, opts.Programs)
+		prog, err := newProgramWithPin(progSpec, opts.Programs, opts.PinPath)
 		if err != nil {
 			return nil, errors.Wrapf(err, "program %s", progName)
 		}
 		progs[progSpec.SectionName] = prog
+		if progSpec.PinPath != "" {
+			progPinPaths[progSpec.SectionName] = progSpec.PinPath
+		}
+	}
+
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		return nil, errors.Errorf("unresolved extern map symbols: %s (set CollectionOptions.MapReplacements or Externs)", strings.Join(unresolved, ", "))
+	}
+
+	externNames := make([]string, 0, len(expectedExterns))
+	for name := range expectedExterns {
+		externNames = append(externNames, name)
 	}
+	sort.Strings(externNames)
 
 	return &Collection{
-		progs,
-		maps,
+		Programs:     progs,
+		Maps:         maps,
+		mapPinPaths:  mapPinPaths,
+		progPinPaths: progPinPaths,
+		externs:      externNames,
 	}, nil
 }
 
+// resolveExtern looks up an unresolved `extern` map symbol against
+// opts.MapReplacements first, falling back to opts.Externs if set.
+func resolveExtern(sym string, opts CollectionOptions) (*Map, bool) {
+	if m, ok := opts.MapReplacements[sym]; ok {
+		return m, true
+	}
+	if opts.Externs != nil {
+		if m, err := opts.Externs(sym); err == nil && m != nil {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Externs returns the names of the extern map symbols the spec's BTF
+// declares (the .extern datasec's BTF_KIND_VAR entries) — i.e. what the
+// spec expects a caller to satisfy via CollectionOptions.MapReplacements
+// or CollectionOptions.Externs. Loading fails if a program references
+// one of them that couldn't be resolved; names that no program
+// references are listed here without being checked.
+func (coll *Collection) Externs() []string {
+	return coll.externs
+}
+
 // LoadCollection parses an object file and converts it to a collection.
 func LoadCollection(file string) (*Collection, error) {
 	spec, err := LoadCollectionSpec(file)
@@ -222,6 +392,11 @@ func (coll *Collection) AttachCgroupProgram(secName string, cgroupPath string) e
 // The collection mustn't be used afterwards.
 func (coll *Collection) Close() []error {
 	errs := []error{}
+	for secName, closer := range coll.attachments {
+		if errTmp := closer.Close(); errTmp != nil {
+			errs = append(errs, errors.Wrapf(errTmp, "couldn't detach %s", secName))
+		}
+	}
 	for secName, prog := range coll.Programs {
 		if errTmp := prog.Close(); errTmp != nil {
 			errs = append(errs, errors.Wrapf(errTmp, "couldn't close program %s", secName))
@@ -259,6 +434,13 @@ func (coll *Collection) DetachProgram(name string) *Program {
 
 // Pin persits a Collection beyond the lifetime of the process that created it
 //
+// Maps and programs whose spec declared a PinPath are pinned at
+// filepath.Join(dirName, pinPath), which may include subdirectories
+// (e.g. "tetragon/sensors/foo/mymap"); any missing intermediate
+// directories are created. Maps and programs without a PinPath keep the
+// flat dirName/maps/<name> or dirName/programs/<name> layout used by
+// earlier versions of this package.
+//
 // This requires bpffs to be mounted above fileName. See http://cilium.readthedocs.io/en/doc-1.0/kubernetes/install/#mounting-the-bpf-fs-optional
 func (coll *Collection) Pin(dirName string, fileMode os.FileMode) error {
 	err := mkdirIfNotExists(dirName, fileMode)
@@ -272,8 +454,14 @@ func (coll *Collection) Pin(dirName string, fileMode os.FileMode) error {
 			return err
 		}
 		for k, v := range coll.Maps {
-			err := v.Pin(filepath.Join(mapPath, k))
-			if err != nil {
+			path := filepath.Join(mapPath, k)
+			if pinPath, ok := coll.mapPinPaths[k]; ok {
+				path = filepath.Join(dirName, pinPath)
+			}
+			if err := mkdirAllIfNotExists(filepath.Dir(path), fileMode); err != nil {
+				return errors.Wrapf(err, "map %s", k)
+			}
+			if err := v.Pin(path); err != nil {
 				return errors.Wrapf(err, "map %s", k)
 			}
 		}
@@ -285,8 +473,14 @@ func (coll *Collection) Pin(dirName string, fileMode os.FileMode) error {
 			return err
 		}
 		for k, v := range coll.Programs {
-			err = v.Pin(filepath.Join(progPath, k))
-			if err != nil {
+			path := filepath.Join(progPath, k)
+			if pinPath, ok := coll.progPinPaths[k]; ok {
+				path = filepath.Join(dirName, pinPath)
+			}
+			if err := mkdirAllIfNotExists(filepath.Dir(path), fileMode); err != nil {
+				return errors.Wrapf(err, "program %s", k)
+			}
+			if err := v.Pin(path); err != nil {
 				return errors.Wrapf(err, "program %s", k)
 			}
 		}
@@ -305,6 +499,17 @@ func mkdirIfNotExists(dirName string, fileMode os.FileMode) error {
 	return nil
 }
 
+func mkdirAllIfNotExists(dirName string, fileMode os.FileMode) error {
+	_, err := os.Stat(dirName)
+	if err != nil && os.IsNotExist(err) {
+		err = os.MkdirAll(dirName, fileMode)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // LoadPinnedCollection loads a Collection from the pinned directory.
 //
 // Requires at least Linux 4.13, use LoadPinnedCollectionExplicit on
@@ -0,0 +1,49 @@
+package ebpf
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/Gui774ume/ebpf/asm"
+	"github.com/Gui774ume/ebpf/btf"
+)
+
+// applyCORERelocations patches the immediate operands of progSpec's
+// instructions in place, replacing the values clang computed against
+// relos.Local with the equivalent values for the kernel's actual type
+// layout.
+func applyCORERelocations(progSpec *ProgramSpec, relos []btf.CORERelocation, kernel *btf.Spec) error {
+	if len(relos) == 0 {
+		return nil
+	}
+
+	for _, relo := range relos {
+		ins, err := instructionAt(progSpec.Instructions, relo.InsnOff)
+		if err != nil {
+			return errors.Wrapf(err, "CO-RE relocation at offset %d", relo.InsnOff)
+		}
+
+		value, err := relo.Resolve(kernel)
+		if err != nil {
+			return errors.Wrapf(err, "resolving relocation at offset %d", relo.InsnOff)
+		}
+
+		ins.Constant = value
+	}
+
+	return nil
+}
+
+// instructionAt returns the instruction whose raw byte offset within
+// insns is off. Offsets are measured in raw bytecode bytes, not slice
+// indices: a ldimm64 instruction (every map-pointer load) occupies two
+// 8-byte raw slots but a single slice element, so naively dividing off
+// by 8 drifts as soon as any wide instruction precedes the target.
+func instructionAt(insns asm.Instructions, off uint32) (*asm.Instruction, error) {
+	iter := insns.Iterate()
+	for iter.Next() {
+		if uint64(iter.Offset.Bytes()) == uint64(off) {
+			return iter.Ins, nil
+		}
+	}
+	return nil, errors.Errorf("offset %d does not correspond to an instruction", off)
+}
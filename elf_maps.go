@@ -0,0 +1,93 @@
+package ebpf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// bpfMapDef mirrors libbpf's extended `struct bpf_map_def`: the layout
+// clang emits into a classic (non-BTF-defined) "maps" ELF section entry
+// for each map it declares, extended past the kernel's own bpf_map_def
+// with fields only libbpf itself interprets when loading the object.
+type bpfMapDef struct {
+	Type        uint32
+	KeySize     uint32
+	ValueSize   uint32
+	MaxEntries  uint32
+	MapFlags    uint32
+	InnerMapIdx uint32
+	NumaNode    uint32
+
+	// Pinning is libbpf's pinning extension field, set by the
+	// LIBBPF_PIN_BY_NAME macro in the map's C definition.
+	Pinning uint32
+}
+
+// libbpfPinByName is libbpf's LIBBPF_PIN_BY_NAME, the only pinning mode
+// this package understands: it pins (or reuses) the map at
+// filepath.Join(CollectionOptions.PinPath, name), as documented on
+// CollectionOptions.PinPath and implemented by newMapWithPin.
+const libbpfPinByName = 1
+
+// pinPathFromMapDef returns the MapSpec.PinPath that should be set for a
+// map named name whose "maps" section entry decoded to def: name itself
+// if def requests LIBBPF_PIN_BY_NAME, "" otherwise.
+func pinPathFromMapDef(name string, def bpfMapDef) string {
+	if def.Pinning == libbpfPinByName {
+		return name
+	}
+	return ""
+}
+
+// mapPinPathsFromELF decodes f's classic (non-BTF-defined) "maps"
+// section, keyed by the ELF symbol naming each bpfMapDef within it, and
+// returns the PinPath that should be set on every map requesting
+// LIBBPF_PIN_BY_NAME. LoadCollectionSpecFromReader does not call it, so
+// MapSpec.PinPath is not filled in from the ELF by this package. f's
+// object files built with
+// BTF-defined map syntax (BTF_KIND_VAR/.maps, rather than the classic
+// "maps" section) carry pinning as a BTF decl tag instead and aren't
+// covered by this path.
+func mapPinPathsFromELF(f *elf.File) (map[string]string, error) {
+	sec := f.Section("maps")
+	if sec == nil {
+		return nil, nil
+	}
+
+	data, err := sec.Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading maps section")
+	}
+
+	symbols, err := f.Symbols()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading symbol table")
+	}
+
+	const defSize = 32 // 8 uint32 fields
+	pinPaths := make(map[string]string)
+	for _, sym := range symbols {
+		if int(sym.Section) >= len(f.Sections) || f.Sections[sym.Section] != sec || sym.Name == "" {
+			continue
+		}
+
+		start := sym.Value
+		if start+defSize > uint64(len(data)) {
+			return nil, errors.Errorf("map %s: definition out of bounds", sym.Name)
+		}
+
+		var def bpfMapDef
+		if err := binary.Read(bytes.NewReader(data[start:start+defSize]), f.ByteOrder, &def); err != nil {
+			return nil, errors.Wrapf(err, "map %s: decoding definition", sym.Name)
+		}
+
+		if path := pinPathFromMapDef(sym.Name, def); path != "" {
+			pinPaths[sym.Name] = path
+		}
+	}
+
+	return pinPaths, nil
+}
@@ -0,0 +1,182 @@
+// Package perf reads events from a BPF_MAP_TYPE_PERF_EVENT_ARRAY map, the
+// mechanism kprobe/tracepoint programs traditionally use to stream data
+// to userspace (bpf_perf_event_output()).
+package perf
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Record is a single sample (or lost-sample notification) read off one
+// of the per-CPU perf rings.
+type Record struct {
+	// CPU is the id of the CPU the sample was read from.
+	CPU int
+	// RawSample is the raw payload passed to bpf_perf_event_output().
+	RawSample []byte
+	// LostSamples is non-zero if the kernel had to drop samples on this
+	// CPU because userspace wasn't reading fast enough; RawSample is
+	// empty in that case.
+	LostSamples uint64
+}
+
+// ErrClosed is returned by Read after the Reader has been closed.
+var ErrClosed = errors.New("perf reader was closed")
+
+// Reader multiplexes the per-CPU rings of a PERF_EVENT_ARRAY map into a
+// single stream of Records.
+type Reader struct {
+	mu      sync.Mutex
+	rings   []*perfEventRing
+	epollFd int
+	closeFd int
+	closed  bool
+
+	epollEvents  []unix.EpollEvent
+	bufferedRing *perfEventRing
+}
+
+// NewReader creates a Reader over the PERF_EVENT_ARRAY identified by
+// mapFD. perCPUBuffer is the requested size, in bytes, of each per-CPU
+// ring; it is rounded up to the next power-of-two multiple of the page
+// size, plus one page reserved for the ring's metadata header.
+func NewReader(mapFD int, perCPUBuffer int) (*Reader, error) {
+	nCPU, err := onlineCPUCount()
+	if err != nil {
+		return nil, fmt.Errorf("counting online CPUs: %w", err)
+	}
+
+	epollFd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("epoll_create1: %w", err)
+	}
+
+	closeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(epollFd)
+		return nil, fmt.Errorf("eventfd: %w", err)
+	}
+
+	r := &Reader{
+		epollFd: epollFd,
+		closeFd: closeFd,
+	}
+
+	if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, closeFd, &unix.EpollEvent{
+		Events: unix.EPOLLIN,
+		Fd:     int32(closeFd),
+	}); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("registering close eventfd: %w", err)
+	}
+
+	for cpu := 0; cpu < nCPU; cpu++ {
+		ring, err := newPerfEventRing(cpu, perCPUBuffer)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("creating ring for cpu %d: %w", cpu, err)
+		}
+
+		if err := bpfMapUpdateElem(mapFD, cpu, ring.fd); err != nil {
+			ring.Close()
+			r.Close()
+			return nil, fmt.Errorf("installing perf event fd for cpu %d: %w", cpu, err)
+		}
+
+		if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, ring.fd, &unix.EpollEvent{
+			Events: unix.EPOLLIN,
+			Fd:     int32(ring.fd),
+		}); err != nil {
+			ring.Close()
+			r.Close()
+			return nil, fmt.Errorf("registering ring for cpu %d: %w", cpu, err)
+		}
+
+		r.rings = append(r.rings, ring)
+		r.epollEvents = append(r.epollEvents, unix.EpollEvent{})
+	}
+
+	return r, nil
+}
+
+// Read blocks until a Record is available, the Reader is closed (in
+// which case it returns ErrClosed), or an error occurs.
+func (r *Reader) Read() (Record, error) {
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return Record{}, ErrClosed
+		}
+
+		if r.bufferedRing != nil {
+			rec, ok, err := r.bufferedRing.readRecord()
+			if err != nil || !ok {
+				r.bufferedRing = nil
+			}
+			if err != nil {
+				r.mu.Unlock()
+				return Record{}, err
+			}
+			if ok {
+				r.mu.Unlock()
+				return rec, nil
+			}
+		}
+		r.mu.Unlock()
+
+		n, err := unix.EpollWait(r.epollFd, r.epollEvents, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("epoll_wait: %w", err)
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return Record{}, ErrClosed
+		}
+		for i := 0; i < n; i++ {
+			fd := int(r.epollEvents[i].Fd)
+			if fd == r.closeFd {
+				r.mu.Unlock()
+				return Record{}, ErrClosed
+			}
+			for _, ring := range r.rings {
+				if ring.fd == fd {
+					r.bufferedRing = ring
+					break
+				}
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Close wakes any blocked Read and releases the Reader's rings, epoll
+// instance and eventfd. The Reader must not be used afterwards.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	var one uint64 = 1
+	unix.Write(r.closeFd, (*(*[8]byte)(unsafe.Pointer(&one)))[:])
+
+	for _, ring := range r.rings {
+		ring.Close()
+	}
+	unix.Close(r.closeFd)
+	return unix.Close(r.epollFd)
+}
@@ -0,0 +1,204 @@
+package perf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// perfSampleTypeRaw mirrors PERF_SAMPLE_RAW: the sample record
+	// contains bpf_perf_event_output()'s raw payload.
+	perfSampleTypeRaw = 0x400
+
+	// perfRecordLost / perfRecordSample mirror PERF_RECORD_LOST and
+	// PERF_RECORD_SAMPLE.
+	perfRecordLost   = 2
+	perfRecordSample = 9
+)
+
+// perfEventRing wraps one CPU's perf_event_open() fd and its mmap'd ring
+// buffer.
+type perfEventRing struct {
+	cpu      int
+	fd       int
+	mmap     []byte
+	meta     *unix.PerfEventMmapPage
+	pageSize int
+}
+
+func newPerfEventRing(cpu, perCPUBuffer int) (*perfEventRing, error) {
+	pageSize := os.Getpagesize()
+	nPages := roundUpPow2(perCPUBuffer, pageSize) / pageSize
+	if nPages == 0 {
+		nPages = 1
+	}
+	// One extra page for the ring's metadata header, which is not part
+	// of the data area.
+	mmapSize := (nPages + 1) * pageSize
+
+	attr := unix.PerfEventAttr{
+		Type:     unix.PERF_TYPE_SOFTWARE,
+		Config:   unix.PERF_COUNT_SW_BPF_OUTPUT,
+		Sample_type: perfSampleTypeRaw,
+		Sample:   1,
+		Wakeup:   1,
+		Bits:     unix.PerfBitWatermark,
+	}
+
+	fd, err := unix.PerfEventOpen(&attr, -1, cpu, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("perf_event_open: %w", err)
+	}
+
+	mmap, err := unix.Mmap(fd, 0, mmapSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("mmap: %w", err)
+	}
+
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+		unix.Munmap(mmap)
+		unix.Close(fd)
+		return nil, fmt.Errorf("enabling perf event: %w", err)
+	}
+
+	return &perfEventRing{
+		cpu:      cpu,
+		fd:       fd,
+		mmap:     mmap,
+		meta:     (*unix.PerfEventMmapPage)(unsafe.Pointer(&mmap[0])),
+		pageSize: pageSize,
+	}, nil
+}
+
+// readRecord drains at most one record from the ring. ok is false if the
+// ring had nothing new to read, or if the record it consumed was of a
+// type that is skipped.
+func (ring *perfEventRing) readRecord() (Record, bool, error) {
+	data := ring.mmap[ring.pageSize:]
+
+	tail := atomic.LoadUint64(&ring.meta.Data_tail)
+	head := atomic.LoadUint64(&ring.meta.Data_head)
+	if tail == head {
+		return Record{}, false, nil
+	}
+
+	var hdr struct {
+		Type uint32
+		Misc uint16
+		Size uint16
+	}
+	readRingAt(data, tail, (*[8]byte)(unsafe.Pointer(&hdr))[:])
+
+	body := make([]byte, int(hdr.Size)-8)
+	readRingAt(data, tail+8, body)
+
+	atomic.StoreUint64(&ring.meta.Data_tail, tail+uint64(hdr.Size))
+
+	switch hdr.Type {
+	case perfRecordSample:
+		if len(body) < 4 {
+			return Record{}, false, fmt.Errorf("short sample record")
+		}
+		size := binary.LittleEndian.Uint32(body[:4])
+		raw := body[4:]
+		if uint32(len(raw)) > size {
+			raw = raw[:size]
+		}
+		return Record{CPU: ring.cpu, RawSample: raw}, true, nil
+	case perfRecordLost:
+		if len(body) < 16 {
+			return Record{}, false, fmt.Errorf("short lost record")
+		}
+		lost := binary.LittleEndian.Uint64(body[8:16])
+		return Record{CPU: ring.cpu, LostSamples: lost}, true, nil
+	default:
+		// Unknown record types (e.g. PERF_RECORD_THROTTLE) are skipped.
+		return Record{}, false, nil
+	}
+}
+
+// readRingAt copies len(out) bytes starting at ring offset off, wrapping
+// around the ring's data area as needed.
+func readRingAt(data []byte, off uint64, out []byte) {
+	size := uint64(len(data))
+	start := off % size
+	n := copy(out, data[start:])
+	if n < len(out) {
+		copy(out[n:], data[:len(out)-n])
+	}
+}
+
+func (ring *perfEventRing) Close() error {
+	unix.Munmap(ring.mmap)
+	return unix.Close(ring.fd)
+}
+
+func roundUpPow2(n, multipleOf int) int {
+	if n <= 0 {
+		return multipleOf
+	}
+	v := multipleOf
+	for v < n {
+		v *= 2
+	}
+	return v
+}
+
+func onlineCPUCount() (int, error) {
+	data, err := os.ReadFile("/sys/devices/system/cpu/online")
+	if err != nil {
+		return 0, err
+	}
+	return parseCPURange(string(data))
+}
+
+// parseCPURange parses the "0-3,5" style ranges the kernel exposes in
+// /sys/devices/system/cpu/online into a count of CPUs.
+func parseCPURange(s string) (int, error) {
+	count := 0
+	start, inRange := -1, false
+	flush := func(end int) {
+		if end >= start {
+			count += end - start + 1
+		}
+	}
+	num := 0
+	haveDigit := false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			num = num*10 + int(r-'0')
+			haveDigit = true
+		case r == '-':
+			start = num
+			num = 0
+			inRange = true
+		case r == ',' || r == '\n':
+			if haveDigit {
+				if inRange {
+					flush(num)
+				} else {
+					count++
+				}
+			}
+			num, haveDigit, inRange = 0, false, false
+		}
+	}
+	if haveDigit {
+		if inRange {
+			flush(num)
+		} else {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("couldn't parse CPU range %q", s)
+	}
+	return count, nil
+}
@@ -0,0 +1,76 @@
+package perf
+
+import "testing"
+
+func TestRoundUpPow2(t *testing.T) {
+	tests := []struct {
+		n, multipleOf, want int
+	}{
+		{0, 4096, 4096},
+		{-1, 4096, 4096},
+		{1, 4096, 4096},
+		{4096, 4096, 4096},
+		{4097, 4096, 8192},
+		{3, 2, 4},
+	}
+	for _, tt := range tests {
+		if got := roundUpPow2(tt.n, tt.multipleOf); got != tt.want {
+			t.Errorf("roundUpPow2(%d, %d) = %d, want %d", tt.n, tt.multipleOf, got, tt.want)
+		}
+	}
+}
+
+func TestParseCPURange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"0\n", 1, false},
+		{"0-3\n", 4, false},
+		{"0-3,5\n", 5, false},
+		{"0,2,4\n", 3, false},
+		{"0-1,3-5\n", 5, false},
+		{"", 0, true},
+		{"\n", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCPURange(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCPURange(%q): expected error, got %d", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseCPURange(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("parseCPURange(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadRingAt(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+
+	out := make([]byte, 4)
+	readRingAt(data, 2, out)
+	if want := []byte{2, 3, 4, 5}; string(out) != string(want) {
+		t.Errorf("readRingAt(data, 2, out) = %v, want %v", out, want)
+	}
+
+	// Wraps around the end of the ring back to the start.
+	out = make([]byte, 4)
+	readRingAt(data, 6, out)
+	if want := []byte{6, 7, 0, 1}; string(out) != string(want) {
+		t.Errorf("readRingAt(data, 6, out) = %v, want %v (wrap-around)", out, want)
+	}
+
+	// An offset larger than the ring wraps via modulo.
+	out = make([]byte, 2)
+	readRingAt(data, 10, out)
+	if want := []byte{2, 3}; string(out) != string(want) {
+		t.Errorf("readRingAt(data, 10, out) = %v, want %v", out, want)
+	}
+}
@@ -0,0 +1,37 @@
+package perf
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const bpfCmdMapUpdateElem = 2
+
+type bpfMapUpdateElemAttr struct {
+	MapFd uint32
+	_     uint32
+	Key   uint64
+	Value uint64
+	Flags uint64
+}
+
+// bpfMapUpdateElem installs value (a perf event fd) at key (a CPU
+// number) into the PERF_EVENT_ARRAY map identified by mapFD, which is
+// how the kernel learns which ring to write a given CPU's samples into.
+func bpfMapUpdateElem(mapFD, key, value int) error {
+	k := uint32(key)
+	v := uint32(value)
+
+	attr := bpfMapUpdateElemAttr{
+		MapFd: uint32(mapFD),
+		Key:   uint64(uintptr(unsafe.Pointer(&k))),
+		Value: uint64(uintptr(unsafe.Pointer(&v))),
+	}
+
+	_, _, errno := unix.Syscall(unix.SYS_BPF, bpfCmdMapUpdateElem, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
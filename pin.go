@@ -0,0 +1,74 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// newMapWithPin creates mapSpec's map, unless it declares a PinPath (set
+// from a LIBBPF_PIN_BY_NAME map definition in the ELF), in which case an
+// existing map already pinned at filepath.Join(basePinPath, mapSpec.PinPath)
+// is reused instead, and a newly created one is pinned there. This lets
+// independent Collections, possibly in different processes, share state
+// through a named pinned map.
+func newMapWithPin(mapSpec *MapSpec, basePinPath string) (*Map, error) {
+	if mapSpec.PinPath == "" {
+		return NewMap(mapSpec)
+	}
+
+	path := filepath.Join(basePinPath, mapSpec.PinPath)
+	if _, err := os.Stat(path); err == nil {
+		return LoadPinnedMap(path)
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "stat pinned map %s", path)
+	}
+
+	m, err := NewMap(mapSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mkdirAllIfNotExists(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating directory for pinned map %s", path)
+	}
+	if err := m.Pin(path); err != nil {
+		return nil, errors.Wrapf(err, "pinning map at %s", path)
+	}
+
+	return m, nil
+}
+
+// newProgramWithPin mirrors newMapWithPin for programs: unless progSpec
+// declares a PinPath (set from a LIBBPF_PIN_BY_NAME program definition
+// in the ELF), it just creates the program, but if one is declared an
+// existing program already pinned at filepath.Join(basePinPath,
+// progSpec.PinPath) is reused instead, and a newly created one is pinned
+// there.
+func newProgramWithPin(progSpec *ProgramSpec, opts ProgramOptions, basePinPath string) (*Program, error) {
+	if progSpec.PinPath == "" {
+		return NewProgramWithOptions(progSpec, opts)
+	}
+
+	path := filepath.Join(basePinPath, progSpec.PinPath)
+	if _, err := os.Stat(path); err == nil {
+		return LoadPinnedProgram(path)
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "stat pinned program %s", path)
+	}
+
+	prog, err := NewProgramWithOptions(progSpec, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mkdirAllIfNotExists(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrapf(err, "creating directory for pinned program %s", path)
+	}
+	if err := prog.Pin(path); err != nil {
+		return nil, errors.Wrapf(err, "pinning program at %s", path)
+	}
+
+	return prog, nil
+}
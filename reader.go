@@ -0,0 +1,46 @@
+package ebpf
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/Gui774ume/ebpf/perf"
+	"github.com/Gui774ume/ebpf/ringbuf"
+)
+
+// OpenPerfReader locates the BPF_MAP_TYPE_PERF_EVENT_ARRAY map named
+// mapName in the collection and returns a reader that multiplexes its
+// per-CPU rings. perCPUBuffer is the requested size, in bytes, of each
+// CPU's ring.
+func (coll *Collection) OpenPerfReader(mapName string, perCPUBuffer int) (*perf.Reader, error) {
+	m, ok := coll.Maps[mapName]
+	if !ok {
+		return nil, errors.Wrapf(errors.New("map not found"), "couldn't open perf reader for %s", mapName)
+	}
+	if m.ABI().Type != PerfEventArray {
+		return nil, errors.Wrapf(errors.New("not a perf event array"), "couldn't open perf reader for %s", mapName)
+	}
+
+	r, err := perf.NewReader(m.FD(), perCPUBuffer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open perf reader for %s", mapName)
+	}
+	return r, nil
+}
+
+// OpenRingbufReader locates the BPF_MAP_TYPE_RINGBUF map named mapName
+// in the collection and returns a reader over it.
+func (coll *Collection) OpenRingbufReader(mapName string) (*ringbuf.Reader, error) {
+	m, ok := coll.Maps[mapName]
+	if !ok {
+		return nil, errors.Wrapf(errors.New("map not found"), "couldn't open ringbuf reader for %s", mapName)
+	}
+	if m.ABI().Type != RingBuf {
+		return nil, errors.Wrapf(errors.New("not a ringbuf map"), "couldn't open ringbuf reader for %s", mapName)
+	}
+
+	r, err := ringbuf.NewReader(m.FD(), int(m.ABI().MaxEntries))
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open ringbuf reader for %s", mapName)
+	}
+	return r, nil
+}
@@ -0,0 +1,219 @@
+// Package ringbuf reads records from a BPF_MAP_TYPE_RINGBUF map (the
+// single shared ring introduced in Linux 5.8, used via
+// bpf_ringbuf_output()/bpf_ringbuf_reserve()+bpf_ringbuf_submit()).
+package ringbuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// busyBit/discardBit mirror BPF_RINGBUF_BUSY_BIT and
+// BPF_RINGBUF_DISCARD_BIT, set in a record's length header.
+const (
+	busyBit    = uint32(1) << 31
+	discardBit = uint32(1) << 30
+	lenMask    = busyBit | discardBit
+)
+
+// Record is a single entry submitted to the ring via
+// bpf_ringbuf_output/submit.
+type Record struct {
+	RawSample []byte
+}
+
+// ErrClosed is returned by Read after the Reader has been closed.
+var ErrClosed = errors.New("ringbuf reader was closed")
+
+// Reader reads records out of a BPF_MAP_TYPE_RINGBUF map. Unlike perf
+// event arrays, a ringbuf map has a single, shared ring, so the map's fd
+// itself (rather than one perf_event fd per CPU) is what's mmap'd and
+// polled.
+type Reader struct {
+	mu      sync.Mutex
+	mapFD   int
+	prodRB  []byte // producer pages: producer position page, then read-only data
+	consRB  []byte // consumer page: consumer position, read-write
+	epollFd int
+	closeFd int
+	closed  bool
+}
+
+// NewReader creates a Reader over the RINGBUF map identified by mapFD.
+// maxEntries must match the map's max_entries (its size in bytes, a
+// power of two): the kernel mmaps one read-write page for the consumer
+// position, followed by one read-only page for the producer position
+// and the maxEntries-byte data area mapped twice back to back
+// (2*maxEntries bytes).
+func NewReader(mapFD int, maxEntries int) (*Reader, error) {
+	pageSize := os.Getpagesize()
+
+	consRB, err := unix.Mmap(mapFD, 0, pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mmap consumer page: %w", err)
+	}
+
+	prodRB, err := unix.Mmap(mapFD, int64(pageSize), pageSize+2*maxEntries, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		unix.Munmap(consRB)
+		return nil, fmt.Errorf("mmap producer pages: %w", err)
+	}
+
+	epollFd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		unix.Munmap(consRB)
+		unix.Munmap(prodRB)
+		return nil, fmt.Errorf("epoll_create1: %w", err)
+	}
+
+	closeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(epollFd)
+		unix.Munmap(consRB)
+		unix.Munmap(prodRB)
+		return nil, fmt.Errorf("eventfd: %w", err)
+	}
+
+	if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, mapFD, &unix.EpollEvent{
+		Events: unix.EPOLLIN,
+		Fd:     int32(mapFD),
+	}); err != nil {
+		unix.Close(epollFd)
+		unix.Close(closeFd)
+		unix.Munmap(consRB)
+		unix.Munmap(prodRB)
+		return nil, fmt.Errorf("registering map fd: %w", err)
+	}
+	if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, closeFd, &unix.EpollEvent{
+		Events: unix.EPOLLIN,
+		Fd:     int32(closeFd),
+	}); err != nil {
+		unix.Close(epollFd)
+		unix.Close(closeFd)
+		unix.Munmap(consRB)
+		unix.Munmap(prodRB)
+		return nil, fmt.Errorf("registering close eventfd: %w", err)
+	}
+
+	return &Reader{
+		mapFD:   mapFD,
+		consRB:  consRB,
+		prodRB:  prodRB,
+		epollFd: epollFd,
+		closeFd: closeFd,
+	}, nil
+}
+
+// Read blocks until a Record is available, the Reader is closed (in
+// which case it returns ErrClosed), or an error occurs.
+func (r *Reader) Read() (Record, error) {
+	for {
+		if rec, ok := r.readRecord(); ok {
+			return rec, nil
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return Record{}, ErrClosed
+		}
+		r.mu.Unlock()
+
+		events := make([]unix.EpollEvent, 2)
+		n, err := unix.EpollWait(r.epollFd, events, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("epoll_wait: %w", err)
+		}
+		for i := 0; i < n; i++ {
+			if int(events[i].Fd) == r.closeFd {
+				return Record{}, ErrClosed
+			}
+		}
+	}
+}
+
+func (r *Reader) readRecord() (Record, bool) {
+	prodPos := (*uint64)(unsafe.Pointer(&r.prodRB[0]))
+	consPos := (*uint64)(unsafe.Pointer(&r.consRB[0]))
+	data := r.prodRB[pageAligned():]
+
+	cons := atomic.LoadUint64(consPos)
+	prod := atomic.LoadUint64(prodPos)
+	if cons == prod {
+		return Record{}, false
+	}
+
+	sample, busy, discard, roundedLen := decodeRingRecord(data, cons)
+	if busy {
+		return Record{}, false
+	}
+
+	atomic.StoreUint64(consPos, cons+roundedLen)
+
+	if discard {
+		return r.readRecord()
+	}
+
+	return Record{RawSample: sample}, true
+}
+
+// decodeRingRecord decodes the record header at ring offset cons within
+// data and copies out its sample. data is the double-mapped region
+// (2*maxEntries bytes): the same ring is mapped twice back to back so
+// that a contiguous read never has to wrap mid-copy. The ring itself is
+// only maxEntries bytes, so the mask must wrap at that size, not at
+// len(data). roundedLen is the number of bytes the consumer position
+// must advance by to move past this record; it is meaningless when busy
+// is true, since the record hasn't been fully submitted yet.
+func decodeRingRecord(data []byte, cons uint64) (sample []byte, busy, discard bool, roundedLen uint64) {
+	mask := uint64(len(data)/2 - 1)
+	header := binary.LittleEndian.Uint32(data[cons&mask:])
+	if header&busyBit != 0 {
+		return nil, true, false, 0
+	}
+
+	length := header &^ lenMask
+	start := (cons + 8) & mask
+	if start+uint64(length) <= uint64(len(data)) {
+		sample = append([]byte(nil), data[start:start+uint64(length)]...)
+	} else {
+		sample = make([]byte, length)
+		n := copy(sample, data[start:])
+		copy(sample[n:], data[:uint64(length)-uint64(n)])
+	}
+
+	roundedLen = (uint64(length) + 8 + 7) &^ 7
+	return sample, false, header&discardBit != 0, roundedLen
+}
+
+func pageAligned() int { return os.Getpagesize() }
+
+// Close wakes any blocked Read and releases the Reader's mmaps, epoll
+// instance and eventfd. The Reader must not be used afterwards.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	var one uint64 = 1
+	unix.Write(r.closeFd, (*(*[8]byte)(unsafe.Pointer(&one)))[:])
+
+	unix.Munmap(r.consRB)
+	unix.Munmap(r.prodRB)
+	unix.Close(r.closeFd)
+	return unix.Close(r.epollFd)
+}
@@ -0,0 +1,102 @@
+package ringbuf
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// ringData builds an 8-byte header + payload record at offset off within
+// a double-mapped ring of the given size, for feeding to
+// decodeRingRecord.
+func ringData(t *testing.T, size int, off uint64, header uint32, payload []byte) []byte {
+	t.Helper()
+
+	data := make([]byte, 2*size)
+	mask := uint64(size - 1)
+	binary.LittleEndian.PutUint32(data[off&mask:], header)
+	start := (off + 8) & mask
+	if int(start)+len(payload) <= len(data) {
+		copy(data[start:], payload)
+	} else {
+		n := copy(data[start:], payload)
+		copy(data[:len(payload)-n], payload[n:])
+	}
+	return data
+}
+
+func TestDecodeRingRecordSimple(t *testing.T) {
+	payload := []byte{1, 2, 3, 4}
+	data := ringData(t, 16, 0, uint32(len(payload)), payload)
+
+	sample, busy, discard, roundedLen := decodeRingRecord(data, 0)
+	if busy || discard {
+		t.Fatalf("busy=%v discard=%v, want false, false", busy, discard)
+	}
+	if string(sample) != string(payload) {
+		t.Errorf("sample = %v, want %v", sample, payload)
+	}
+	if want := uint64(16); roundedLen != want {
+		t.Errorf("roundedLen = %d, want %d (8 byte header + 4 byte payload rounded up to 8)", roundedLen, want)
+	}
+}
+
+func TestDecodeRingRecordWrapsAroundRing(t *testing.T) {
+	// A ring of size 16 with cons positioned so the 8-byte header runs
+	// past the end of the ring and the payload offset wraps to the front.
+	const size = 16
+	payload := []byte{1, 2, 3, 4, 5, 6}
+	cons := uint64(size - 4) // length word at [12:16), payload at (cons+8)&mask = [4:10)
+	data := ringData(t, size, cons, uint32(len(payload)), payload)
+
+	sample, busy, discard, _ := decodeRingRecord(data, cons)
+	if busy || discard {
+		t.Fatalf("busy=%v discard=%v, want false, false", busy, discard)
+	}
+	if string(sample) != string(payload) {
+		t.Errorf("sample = %v, want %v (wrap-around read)", sample, payload)
+	}
+}
+
+func TestDecodeRingRecordBusy(t *testing.T) {
+	data := ringData(t, 16, 0, busyBit|4, nil)
+
+	_, busy, _, _ := decodeRingRecord(data, 0)
+	if !busy {
+		t.Errorf("busy = false, want true")
+	}
+}
+
+func TestDecodeRingRecordDiscard(t *testing.T) {
+	payload := []byte{1, 2, 3, 4}
+	data := ringData(t, 16, 0, discardBit|uint32(len(payload)), payload)
+
+	_, busy, discard, roundedLen := decodeRingRecord(data, 0)
+	if busy {
+		t.Fatalf("busy = true, want false")
+	}
+	if !discard {
+		t.Errorf("discard = false, want true")
+	}
+	if want := uint64(16); roundedLen != want {
+		t.Errorf("roundedLen = %d, want %d", roundedLen, want)
+	}
+}
+
+func TestDecodeRingRecordMasksAtRingSizeNotDataLen(t *testing.T) {
+	// Regression test: the mask must wrap at maxEntries (the ring's
+	// real size), not at len(data) (2*maxEntries, the double-mapped
+	// region). Using the wrong size here would read the header from
+	// the wrong half of data.
+	const size = 16
+	payload := []byte{9, 9, 9, 9}
+	cons := uint64(size) // one full lap around the ring
+	data := ringData(t, size, 0, uint32(len(payload)), payload)
+
+	sample, busy, discard, _ := decodeRingRecord(data, cons)
+	if busy || discard {
+		t.Fatalf("busy=%v discard=%v, want false, false", busy, discard)
+	}
+	if string(sample) != string(payload) {
+		t.Errorf("sample = %v, want %v", sample, payload)
+	}
+}